@@ -69,3 +69,7 @@ require (
 // that we do not rely upon. It appears to introduce performance regressions
 // for us.
 exclude github.com/go-sql-driver/mysql v1.6.0
+
+// Boulder's changes to challtestsrv live in third_party/challtestsrv until they
+// are released upstream. Run `go mod vendor` after changing it.
+replace github.com/letsencrypt/challtestsrv => ./third_party/challtestsrv
@@ -0,0 +1,146 @@
+package challtestsrv_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+const benchmarkChallenges = 1000
+
+// benchmarkAdd measures challenge lookups by parallel readers while a writer
+// goroutine repeatedly provisions challenges for all of the keys with
+// provision, and reports how many challenges the writer added per second as
+// adds/s. Comparing the "each" and "batch" sub-benchmarks of the BenchmarkAdd*
+// benchmarks shows how much faster challenges are provisioned when the writer
+// takes the challenge lock once per batch instead of competing with the
+// readers for it once per challenge. The readers' ns/op goes up with batches,
+// since a lookup may have to wait for a whole batch to be added.
+func benchmarkAdd(
+	b *testing.B,
+	keys []string,
+	provision func(*challtestsrv.ChallSrv),
+	lookup func(srv *challtestsrv.ChallSrv, key string),
+) {
+	srv, _ := challtestsrvtest.NewTestServer(b, challtestsrv.Config{})
+
+	stop := make(chan struct{})
+	added := make(chan int)
+	provisioning := make(chan struct{})
+	go func() {
+		// The first round isn't counted, it only gets the writer going before
+		// the timer starts so that even the short runs the benchmark framework
+		// uses to pick b.N measure contended lookups.
+		provision(srv)
+		srv.DeleteAllChallenges()
+		close(provisioning)
+
+		n := 0
+		for {
+			select {
+			case <-stop:
+				added <- n
+				return
+			default:
+			}
+			provision(srv)
+			srv.DeleteAllChallenges()
+			n += len(keys)
+		}
+	}()
+
+	<-provisioning
+	start := time.Now()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			lookup(srv, keys[i%len(keys)])
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	b.ReportMetric(float64(<-added)/time.Since(start).Seconds(), "adds/s")
+}
+
+func benchmarkKeys(format string) []string {
+	keys := make([]string, benchmarkChallenges)
+	for i := range keys {
+		keys[i] = fmt.Sprintf(format, i)
+	}
+	return keys
+}
+
+func BenchmarkAddTLSALPNChallenges(b *testing.B) {
+	hosts := benchmarkKeys("host-%d.example.com")
+	batch := make(map[string]string, len(hosts))
+	for _, host := range hosts {
+		batch[host] = "tls"
+	}
+	lookup := func(srv *challtestsrv.ChallSrv, host string) {
+		srv.GetTLSALPNChallenge(host)
+	}
+
+	b.Run("each", func(b *testing.B) {
+		benchmarkAdd(b, hosts, func(srv *challtestsrv.ChallSrv) {
+			for _, host := range hosts {
+				srv.AddTLSALPNChallenge(host, "tls")
+			}
+		}, lookup)
+	})
+	b.Run("batch", func(b *testing.B) {
+		benchmarkAdd(b, hosts, func(srv *challtestsrv.ChallSrv) {
+			srv.AddTLSALPNChallenges(batch)
+		}, lookup)
+	})
+}
+
+func BenchmarkAddHTTPOneChallenges(b *testing.B) {
+	tokens := benchmarkKeys("token-%d")
+	batch := make(map[string]string, len(tokens))
+	for _, token := range tokens {
+		batch[token] = "http"
+	}
+	lookup := func(srv *challtestsrv.ChallSrv, token string) {
+		srv.GetHTTPOneChallenge(token)
+	}
+
+	b.Run("each", func(b *testing.B) {
+		benchmarkAdd(b, tokens, func(srv *challtestsrv.ChallSrv) {
+			for _, token := range tokens {
+				srv.AddHTTPOneChallenge(token, "http")
+			}
+		}, lookup)
+	})
+	b.Run("batch", func(b *testing.B) {
+		benchmarkAdd(b, tokens, func(srv *challtestsrv.ChallSrv) {
+			srv.AddHTTPOneChallenges(batch)
+		}, lookup)
+	})
+}
+
+func BenchmarkAddDNSOneChallenges(b *testing.B) {
+	hosts := benchmarkKeys("_acme-challenge.host-%d.example.com.")
+	batch := make(map[string][]string, len(hosts))
+	for _, host := range hosts {
+		batch[host] = []string{"dns"}
+	}
+	lookup := func(srv *challtestsrv.ChallSrv, host string) {
+		srv.GetDNSOneChallenge(host)
+	}
+
+	b.Run("each", func(b *testing.B) {
+		benchmarkAdd(b, hosts, func(srv *challtestsrv.ChallSrv) {
+			for _, host := range hosts {
+				srv.AddDNSOneChallenge(host, "dns")
+			}
+		}, lookup)
+	})
+	b.Run("batch", func(b *testing.B) {
+		benchmarkAdd(b, hosts, func(srv *challtestsrv.ChallSrv) {
+			srv.AddDNSOneChallenges(batch)
+		}, lookup)
+	})
+}
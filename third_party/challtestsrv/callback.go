@@ -0,0 +1,67 @@
+package challtestsrv
+
+import "time"
+
+// maxValidatedChallenges is the number of events remembered for
+// ValidatedChallenges.
+const maxValidatedChallenges = 100
+
+// ChallengeEvent describes a challenge request answered by one of the
+// challenge servers. It is passed to the function registered with
+// SetChallengeCallback.
+type ChallengeEvent struct {
+	// Type is the type of challenge server that answered the request.
+	Type RequestEventType
+	// Identifier is the HTTP-01 token, DNS question name or TLS-ALPN-01 SNI
+	// value the request was for.
+	Identifier string
+	// Outcome describes how the request was answered, e.g. "served-challenge"
+	// or "unknown-sni".
+	Outcome string
+	// Time is when the request was answered.
+	Time time.Time
+}
+
+// SetChallengeCallback registers a function called with a ChallengeEvent
+// every time the HTTP-01, DNS-01 or TLS-ALPN-01 challenge server answers
+// a request. The function is called in its own goroutine so it never delays
+// the response, which also means it may be called concurrently and events may
+// arrive out of order. Use nil to remove the callback.
+func (s *ChallSrv) SetChallengeCallback(f func(ChallengeEvent)) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.challengeCallback = f
+}
+
+// ValidatedChallenges returns the most recent events for requests answered with
+// a challenge response, oldest first: HTTP-01 requests served a key
+// authorization, DNS TXT questions answered with records and acme-tls/1
+// handshakes served a challenge certificate. This is useful for asserting which
+// challenge type a client used, e.g. that it didn't fall back to another one.
+func (s *ChallSrv) ValidatedChallenges() []ChallengeEvent {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	events := make([]ChallengeEvent, len(s.validatedChallenges))
+	copy(events, s.validatedChallenges)
+	return events
+}
+
+// notifyChallenge timestamps the given event and asynchronously passes it to
+// the callback registered with SetChallengeCallback, if any. If served is true
+// the request was answered with a challenge response and the event is also
+// recorded for ValidatedChallenges.
+func (s *ChallSrv) notifyChallenge(event ChallengeEvent, served bool) {
+	event.Time = time.Now()
+	s.challMu.Lock()
+	f := s.challengeCallback
+	if served {
+		if len(s.validatedChallenges) >= maxValidatedChallenges {
+			s.validatedChallenges = s.validatedChallenges[1:]
+		}
+		s.validatedChallenges = append(s.validatedChallenges, event)
+	}
+	s.challMu.Unlock()
+	if f != nil {
+		go f(event)
+	}
+}
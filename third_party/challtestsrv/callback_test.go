@@ -0,0 +1,122 @@
+package challtestsrv_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestChallengeCallback(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", "http")
+	srv.AddDNSOneChallenge("_acme-challenge.example.com.", "dns")
+	srv.AddTLSALPNChallenge("example.com", "tls")
+
+	events := make(chan challtestsrv.ChallengeEvent, 10)
+	srv.SetChallengeCallback(func(e challtestsrv.ChallengeEvent) { events <- e })
+
+	getHTTPOne(t, srv, "token")
+	queryDNS(t, srv, "udp", "_acme-challenge.example.com", dns.TypeTXT)
+	if _, err := handshakeTLSALPN(srv, "example.com"); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	_, _ = handshakeTLSALPN(srv, "unknown.example.com")
+
+	// The callback runs in its own goroutine so events may arrive in any order.
+	var got []string
+	for i := 0; i < 4; i++ {
+		select {
+		case e := <-events:
+			if e.Time.IsZero() {
+				t.Errorf("event %+v has no Time", e)
+			}
+			got = append(got, e.Identifier+" "+e.Outcome)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d callback events, want 4: %q", len(got), got)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"_acme-challenge.example.com. answered",
+		"example.com served-challenge",
+		"token served-challenge",
+		"unknown.example.com unknown-sni",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("callback events = %q, want %q", got, want)
+			break
+		}
+	}
+
+	// Only requests answered with a challenge response are validated.
+	validated := srv.ValidatedChallenges()
+	wantTypes := []challtestsrv.RequestEventType{
+		challtestsrv.HTTPRequestEventType,
+		challtestsrv.DNSRequestEventType,
+		challtestsrv.TLSALPNRequestEventType,
+	}
+	if len(validated) != len(wantTypes) {
+		t.Fatalf("got %d ValidatedChallenges, want %d: %+v", len(validated), len(wantTypes), validated)
+	}
+	for i, e := range validated {
+		if e.Type != wantTypes[i] {
+			t.Errorf("ValidatedChallenges()[%d].Type = %d, want %d", i, e.Type, wantTypes[i])
+		}
+	}
+
+	// Removing the callback stops further events.
+	srv.SetChallengeCallback(nil)
+	getHTTPOne(t, srv, "token")
+	select {
+	case e := <-events:
+		t.Errorf("got callback event %+v after removing the callback", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestValidatedChallenges(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSOneChallenge("_acme-challenge.example.com.", "dns")
+	srv.AddDNSARecord("_acme-challenge.example.com", []string{"192.0.2.1"})
+
+	// Requests that aren't answered with a challenge response aren't
+	// recorded.
+	start := time.Now()
+	queryDNS(t, srv, "udp", "_acme-challenge.example.com", dns.TypeA)
+	getHTTPOne(t, srv, "missing-token")
+	_, _ = handshakeTLSALPN(srv, "unknown.example.com")
+	if got := srv.ValidatedChallenges(); len(got) != 0 {
+		t.Fatalf("ValidatedChallenges() = %+v, want none", got)
+	}
+
+	queryDNS(t, srv, "udp", "_acme-challenge.example.com", dns.TypeTXT)
+	got := srv.ValidatedChallenges()
+	if len(got) != 1 {
+		t.Fatalf("got %d ValidatedChallenges, want 1: %+v", len(got), got)
+	}
+	if got[0].Identifier != "_acme-challenge.example.com." || got[0].Outcome != "answered" {
+		t.Errorf("ValidatedChallenges()[0] = %+v, want the answered TXT question", got[0])
+	}
+	if got[0].Time.Before(start) || got[0].Time.After(time.Now()) {
+		t.Errorf("ValidatedChallenges()[0].Time = %s, want the time of the query", got[0].Time)
+	}
+
+	// Only the most recent events are kept.
+	for i := 0; i < 100; i++ {
+		srv.AddHTTPOneChallenge(fmt.Sprintf("token-%d", i), "http")
+		getHTTPOne(t, srv, fmt.Sprintf("token-%d", i))
+	}
+	got = srv.ValidatedChallenges()
+	if len(got) != 100 {
+		t.Fatalf("got %d ValidatedChallenges after 101 responses, want 100", len(got))
+	}
+	if got[0].Identifier != "token-0" || got[99].Identifier != "token-99" {
+		t.Errorf("ValidatedChallenges() runs from %q to %q, want token-0 to token-99", got[0].Identifier, got[99].Identifier)
+	}
+}
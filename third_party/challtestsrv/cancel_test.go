@@ -0,0 +1,123 @@
+package challtestsrv_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+// TestDelayedRequestCancelled checks that HTTP-01 and DNS-over-HTTPS requests
+// waiting out an injected delay are abandoned without a response once the
+// client goes away, instead of holding the handler until the delay is over.
+func TestDelayedRequestCancelled(t *testing.T) {
+	const token = "slow-token"
+	const keyAuth = "slow-token.key-authorization"
+	const name = "_acme-challenge.slow.example.com."
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		DOHAddrs: []string{"127.0.0.1:0"},
+	})
+	srv.AddHTTPOneChallenge(token, keyAuth)
+	srv.SetHTTPOneDelay(token, time.Minute)
+	srv.AddDNSOneChallenge(name, "slow")
+	srv.SetDNSDelay(name, time.Minute)
+
+	events := make(chan challtestsrv.ChallengeEvent, 10)
+	srv.SetChallengeCallback(func(e challtestsrv.ChallengeEvent) { events <- e })
+
+	query := new(dns.Msg)
+	query.SetQuestion(name, dns.TypeTXT)
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		dial       func() (net.Conn, error)
+		request    string
+		identifier string
+	}{
+		{
+			name: "HTTP-01",
+			dial: func() (net.Conn, error) { return net.Dial("tcp", srv.HTTPOneAddr()) },
+			request: "GET /.well-known/acme-challenge/" + token + " HTTP/1.1\r\n" +
+				"Host: slow.example.com\r\n\r\n",
+			identifier: token,
+		},
+		{
+			name: "DNS-over-HTTPS",
+			dial: func() (net.Conn, error) {
+				return tls.Dial("tcp", srv.DOHAddr(), &tls.Config{InsecureSkipVerify: true})
+			},
+			request: fmt.Sprintf("POST /dns-query HTTP/1.1\r\n"+
+				"Host: slow.example.com\r\n"+
+				"Content-Type: application/dns-message\r\n"+
+				"Content-Length: %d\r\n\r\n%s", len(packed), packed),
+			identifier: name,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := tc.dial()
+			if err != nil {
+				t.Fatalf("dialing: %s", err)
+			}
+			defer conn.Close()
+			if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(conn, tc.request); err != nil {
+				t.Fatalf("writing request: %s", err)
+			}
+
+			// Give the handler time to start waiting out the delay, then close
+			// the client's side of the connection, which the server notices as
+			// the client going away.
+			time.Sleep(100 * time.Millisecond)
+			if err := conn.(interface{ CloseWrite() error }).CloseWrite(); err != nil {
+				t.Fatalf("closing the connection for writing: %s", err)
+			}
+
+			// The handler returns long before the delay is over. It writes
+			// nothing, so net/http sends its empty 200 response.
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatalf("reading response: %s", err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("reading response body: %s", err)
+			}
+			if resp.StatusCode != http.StatusOK || len(body) != 0 {
+				t.Errorf("got a %d response with body %q after the client went away, want an empty 200",
+					resp.StatusCode, body)
+			}
+
+			for {
+				select {
+				case e := <-events:
+					if e.Identifier != tc.identifier {
+						continue
+					}
+					if e.Outcome != "aborted" {
+						t.Errorf("request outcome = %q, want %q", e.Outcome, "aborted")
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("no event for the abandoned request")
+				}
+				return
+			}
+		})
+	}
+}
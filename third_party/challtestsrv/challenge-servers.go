@@ -0,0 +1,624 @@
+// Package challtestsrv provides a trivially insecure acme challenge response
+// server for rapidly testing HTTP-01, DNS-01 and TLS-ALPN-01 challenge types.
+package challtestsrv
+
+import (
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Default to using localhost for both A and AAAA queries that don't match
+	// more specific mock host data.
+	defaultIPv4 = "127.0.0.1"
+	defaultIPv6 = "::1"
+)
+
+// challengeServers offer common functionality to start up and shutdown.
+type challengeServer interface {
+	ListenAndServe() error
+	Shutdown() error
+	// Addrs returns the addresses the server's listeners are bound to. It is
+	// empty until ListenAndServe has bound them.
+	Addrs() []string
+}
+
+// ChallSrv is a multi-purpose challenge server. Each ChallSrv may have one or
+// more ACME challenges it provides servers for. It is safe to use concurrently.
+type ChallSrv struct {
+	log *log.Logger
+
+	// tlsALPNLog is an optional logger for TLS-ALPN-01 handshakes.
+	tlsALPNLog *log.Logger
+
+	// tlsALPNProtocol is the ALPN protocol challenge certificates are served
+	// for, normally ACMETLS1Protocol.
+	tlsALPNProtocol string
+	// tlsALPNStrictProtocol is true if challenge certificates are only served
+	// when tlsALPNProtocol is the only offered protocol.
+	tlsALPNStrictProtocol bool
+
+	// metrics holds the Prometheus collectors counting challenge server
+	// activity.
+	metrics challSrvMetrics
+
+	// fallbackCert is the self-signed certificate used by the HTTPS HTTP-01
+	// servers and by default for TLS-ALPN-01 server handshakes that don't
+	// negotiate the acme-tls/1 protocol.
+	fallbackCert tls.Certificate
+
+	// servers are the individual challenge server listeners started in New() and
+	// closed in Shutdown().
+	servers []challengeServer
+
+	// serversByKind holds the same servers as servers grouped by what they
+	// serve, for looking up the addresses they are bound to.
+	serversByKind map[serverKind][]challengeServer
+
+	// challMu is a RWMutex used to control concurrent updates to the challenge
+	// response data maps below.
+	challMu sync.RWMutex
+
+	// requestHistory is a map from hostname to a map of event type to a list of
+	// sequential request events
+	requestHistory map[string]map[RequestEventType][]RequestEvent
+
+	// httpOne is a map of token values to key authorizations used for HTTP-01
+	// responses.
+	httpOne map[string]string
+
+	// httpOneMocks holds per-token settings used to alter HTTP-01 responses.
+	httpOneMocks mockHTTPOneData
+
+	// dnsOne is a map of DNS host values to key authorizations used for DNS-01
+	// responses.
+	dnsOne map[string][]string
+
+	// dnsMocks holds mock DNS data used to respond to DNS queries other than
+	// DNS-01 TXT challenge lookups.
+	dnsMocks mockDNSData
+
+	// dnsRequests is a ring buffer of the most recent DNS queries received,
+	// oldest first. It holds at most maxDNSRequests entries.
+	dnsRequests []DNSRequest
+
+	// tlsALPNOne is a map of token values to key authorizations used for TLS-ALPN-01
+	// responses.
+	tlsALPNOne map[string]string
+
+	// tlsALPNPerSource is a map of host to a map of client IP address to the
+	// key authorization used for TLS-ALPN-01 responses to that client.
+	tlsALPNPerSource map[string]map[string]string
+
+	// tlsALPNRequests is a ring buffer of the most recent TLS-ALPN-01 handshakes
+	// observed, oldest first. It holds at most maxTLSALPNRequests entries.
+	tlsALPNRequests []TLSALPNRequest
+
+	// tlsALPNRequestCounts is a map of host to the number of TLS-ALPN-01
+	// challenge lookups made for handshakes with that host as the SNI value.
+	tlsALPNRequestCounts map[string]int
+
+	// tlsALPNLastCerts is a map of host to the DER of the most recent
+	// TLS-ALPN-01 challenge certificate generated for that host.
+	tlsALPNLastCerts map[string][]byte
+
+	// tlsALPNKey is the key used to sign TLS-ALPN-01 challenge certificates. It
+	// is nil if no TLS-ALPN-01 server was configured.
+	tlsALPNKey crypto.Signer
+
+	// tlsALPNMocks holds per-host settings used to alter the TLS-ALPN-01
+	// challenge certificates built for a host.
+	tlsALPNMocks mockTLSALPNData
+
+	// redirects is a map of paths to URLs. HTTP challenge servers respond to
+	// requests for these paths with a 301 to the corresponding URL.
+	redirects map[string]string
+
+	// stateFile is the file challenges are loaded from and saved to, if any.
+	stateFile string
+	// stateMu serializes saving challenges to stateFile.
+	stateMu sync.Mutex
+
+	// inFlight counts the requests each challenge server listener is handling
+	// for ShutdownWithReport.
+	inFlight *inFlightTracker
+
+	// ctx is cancelled when ShutdownWithReport begins so that handlers waiting
+	// out an injected delay give up instead of finishing their response.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// chaos is the random failure of challenge requests set with
+	// SetChaosFailureRate, if any.
+	chaos *chaosFailures
+
+	// challengeCallback is called asynchronously with a ChallengeEvent for each
+	// challenge request answered. It is nil if no callback was registered.
+	challengeCallback func(ChallengeEvent)
+	// validatedChallenges is a ring buffer of the most recent events for
+	// requests answered with a challenge response.
+	validatedChallenges []ChallengeEvent
+}
+
+// mockDNSData holds mock responses for DNS A, AAAA, and CAA lookups.
+type mockDNSData struct {
+	// The IPv4 address used for all A record responses that don't match a host in
+	// aRecords.
+	defaultIPv4 string
+	// The IPv6 address used for all AAAA record responses that don't match a host
+	// in aaaaRecords.
+	defaultIPv6 string
+	// A map of host to IPv4 addresses in string form for A record responses.
+	aRecords map[string][]string
+	// A map of host to IPv6 addresses in string form for AAAA record responses.
+	aaaaRecords map[string][]string
+	// A map of host to CAA policies for CAA responses.
+	caaRecords map[string][]MockCAAPolicy
+	// A map of host to CNAME records.
+	cnameRecords map[string]string
+	// A map of hostnames that should receive a SERVFAIL response for all queries.
+	servFailRecords map[string]bool
+	// A map of host to the TTL used for answer records for that host.
+	ttls map[string]uint32
+	// A map of host to the rcode returned, with no answers, for all queries.
+	errors map[string]int
+	// A map of hostnames that should receive an empty, truncated response to
+	// queries made over UDP.
+	truncateRecords map[string]bool
+	// A map of hostnames whose queries are refused when made over UDP.
+	tcpOnlyRecords map[string]bool
+	// A map of host to the owner name used for answer records for that host
+	// instead of the queried name.
+	answerNames map[string]string
+	// A map of host to how long to wait before answering queries for that host.
+	delays map[string]time.Duration
+	// The random delay added before answering every query, if any.
+	jitter *dnsJitter
+	// The rcode used for queries of a type that isn't supported.
+	unknownTypeRcode int
+	// A map of zone to the SOA record used in the authority section of
+	// responses for names in that zone.
+	soaRecords map[string]dns.SOA
+}
+
+// MockCAAPolicy holds a tag and a value for a CAA record. See
+// https://tools.ietf.org/html/rfc6844
+type MockCAAPolicy struct {
+	// Flag is the CAA flags byte. Use 128 to set the issuer critical flag.
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+// Config holds challenge server configuration
+type Config struct {
+	Log *log.Logger
+	// Stats is an optional Prometheus Registerer the challenge server's
+	// metrics are registered with. The metrics are always available from
+	// ChallSrv.MetricsHandler.
+	Stats prometheus.Registerer
+	// TLSALPNLog receives a line for each TLS-ALPN-01 handshake describing the
+	// SNI, offered ALPN protocols, whether a challenge was found and how the
+	// handshake was answered. If nil these lines are not logged.
+	TLSALPNLog *log.Logger
+	// HTTPOneAddrs are the HTTP-01 challenge server bind addresses/ports
+	HTTPOneAddrs []string
+	// HTTPSOneAddrs are the HTTPS HTTP-01 challenge server bind addresses/ports
+	HTTPSOneAddrs []string
+	// DNSOneAddrs are the DNS-01 challenge server bind addresses/ports
+	DNSOneAddrs []string
+	// TLSALPNOneAddrs are the TLS-ALPN-01 challenge server bind addresses/ports.
+	// Addresses of the form "unix:/path/to/socket" bind a Unix domain socket,
+	// which is removed again by Shutdown.
+	TLSALPNOneAddrs []string
+	// DOHAddrs are the DNS-over-HTTPS server bind addresses/ports
+	DOHAddrs []string
+	// GRPCAddrs are the gRPC management server bind addresses/ports
+	GRPCAddrs []string
+	// TLSALPNKeyType is the type of key used to sign TLS-ALPN-01 challenge
+	// certificates. Defaults to TLSALPNKeyECDSA.
+	TLSALPNKeyType TLSALPNKeyType
+	// TLSALPNCurve is the elliptic curve used for ECDSA TLS-ALPN-01 challenge
+	// keys and for the self-signed fallback certificate's key. Defaults to
+	// P-256.
+	TLSALPNCurve elliptic.Curve
+	// FallbackCert is the certificate used by the HTTPS HTTP-01 and
+	// DNS-over-HTTPS servers and by default for TLS-ALPN-01 handshakes that
+	// don't negotiate acme-tls/1. If nil New issues a self-signed certificate
+	// with a TLSALPNCurve key for the ChallSrv. See ChallSrv.GetTLSALPNFallbackCert for how the certificates
+	// presented without acme-tls/1 are chosen.
+	FallbackCert *tls.Certificate
+	// FallbackCertNotBefore and FallbackCertNotAfter, if not zero, replace the
+	// NotBefore and NotAfter dates of the self-signed fallback certificate,
+	// which otherwise is valid from an hour ago until a year from now. This is
+	// useful for simulating a server presenting an expired or not yet valid
+	// certificate. They can't be combined with FallbackCert, and New fails if
+	// the resulting NotAfter is before NotBefore.
+	FallbackCertNotBefore time.Time
+	FallbackCertNotAfter  time.Time
+	// TLSALPNReadTimeout is the read timeout of the TLS-ALPN-01 challenge
+	// server. Defaults to 5 seconds.
+	TLSALPNReadTimeout time.Duration
+	// TLSALPNWriteTimeout is the write timeout of the TLS-ALPN-01 challenge
+	// server. Defaults to 5 seconds.
+	TLSALPNWriteTimeout time.Duration
+	// TLSALPNShutdownTimeout is how long Shutdown waits for in-progress
+	// TLS-ALPN-01 connections to finish before closing them. Defaults to
+	// 5 seconds.
+	TLSALPNShutdownTimeout time.Duration
+	// TLSALPNKeepAlives enables HTTP keep-alives on the TLS-ALPN-01 challenge
+	// server. By default they are disabled so every request is made over a new
+	// connection, and so after a new handshake. Enabling them lets clients reuse
+	// a connection, which skips the handshake that serves the challenge
+	// certificate for subsequent requests.
+	TLSALPNKeepAlives bool
+	// TLSALPNClientCAs optionally makes the TLS-ALPN-01 challenge server
+	// require and verify a client certificate signed by one of these CAs for
+	// handshakes that don't negotiate only acme-tls/1, like a server that
+	// demands client certificates for ordinary traffic would. acme-tls/1
+	// handshakes never require a client certificate.
+	TLSALPNClientCAs *x509.CertPool
+	// TLSALPNDisableSessionTickets stops the TLS-ALPN-01 challenge server from
+	// issuing session tickets. By default clients may resume a session, and
+	// a resumed handshake doesn't serve a new challenge certificate.
+	TLSALPNDisableSessionTickets bool
+	// TLSALPNCipherSuites optionally restricts the TLS 1.0-1.2 cipher suites
+	// the TLS-ALPN-01 challenge server accepts. TLS 1.3 cipher suites can't be
+	// configured, so set TLSALPNMaxVersion to tls.VersionTLS12 for the
+	// restriction to apply to every handshake. Defaults to Go's defaults.
+	TLSALPNCipherSuites []uint16
+	// TLSALPNMinVersion and TLSALPNMaxVersion optionally restrict the TLS
+	// versions the TLS-ALPN-01 challenge server accepts, e.g. to
+	// tls.VersionTLS13. Default to Go's defaults.
+	TLSALPNMinVersion uint16
+	TLSALPNMaxVersion uint16
+	// TLSALPNMaxConcurrentHandshakes optionally limits how many connections the
+	// TLS-ALPN-01 challenge server handles at once, across all of its
+	// addresses. Connections beyond the limit are held unaccepted, before their
+	// handshake starts, until an earlier connection is closed. With keep-alives
+	// disabled connections are closed shortly after their handshake, so this
+	// caps concurrent handshakes. Zero means no limit.
+	TLSALPNMaxConcurrentHandshakes int
+	// TLSALPNExtraProtocols are ALPN protocols the TLS-ALPN-01 challenge server
+	// offers in addition to acme-tls/1. Challenge certificates are still only
+	// served when acme-tls/1 is the only protocol offered by the client, unless
+	// TLSALPNStrictProtocol is false.
+	TLSALPNExtraProtocols []string
+	// TLSALPNStrictProtocol controls whether the TLS-ALPN-01 challenge server
+	// only serves challenge certificates to clients offering acme-tls/1 as
+	// their only protocol, as RFC 8737 requires. Handshakes offering other
+	// protocols too then get the fallback certificate. When false, challenge
+	// certificates are served whenever acme-tls/1 is offered, and acme-tls/1 is
+	// negotiated. Defaults to true when nil; see WithTLSALPNStrictProtocol.
+	TLSALPNStrictProtocol *bool
+	// TLSALPNDebugEndpoint makes the TLS-ALPN-01 challenge server answer
+	// requests for TLSHelloDebugPath made without negotiating acme-tls/1 with
+	// a JSON TLSHelloDebug describing the SNI and ALPN protocols the client
+	// sent in its ClientHello.
+	TLSALPNDebugEndpoint bool
+	// TLSALPNProtocol is the ALPN protocol that must be the only one offered by
+	// a client for the TLS-ALPN-01 challenge server to serve it a challenge
+	// certificate. Defaults to ACMETLS1Protocol. Setting it to something else
+	// is only useful for testing how clients behave with a future protocol
+	// version, and acme-tls/1 in the other Config docs then refers to it.
+	TLSALPNProtocol string
+	// ChallengeStateFile optionally names a JSON file used to persist
+	// challenges across restarts. If it exists the challenges it holds are
+	// loaded by New, and the challenges are saved to it every time they are
+	// added or deleted, so they survive the process crashing.
+	ChallengeStateFile string
+}
+
+// validate checks that a challenge server Config is valid. To be valid it must
+// specify a bind address for at least one challenge type. If there is no
+// configured log in the config a default is provided.
+func (c *Config) validate() error {
+	// There needs to be at least one challenge type with a bind address
+	if len(c.HTTPOneAddrs) < 1 &&
+		len(c.HTTPSOneAddrs) < 1 &&
+		len(c.DNSOneAddrs) < 1 &&
+		len(c.DOHAddrs) < 1 &&
+		len(c.TLSALPNOneAddrs) < 1 {
+		return fmt.Errorf(
+			"config must specify at least one HTTPOneAddrs entry, one HTTPSOneAddr " +
+				"entry, one DNSOneAddrs entry, one DOHAddrs entry, or one " +
+				"TLSALPNOneAddrs entry")
+	}
+	if c.TLSALPNMaxConcurrentHandshakes < 0 {
+		return fmt.Errorf("TLSALPNMaxConcurrentHandshakes must not be negative: %d",
+			c.TLSALPNMaxConcurrentHandshakes)
+	}
+	fallbackValidity := !c.FallbackCertNotBefore.IsZero() || !c.FallbackCertNotAfter.IsZero()
+	if fallbackValidity && c.FallbackCert != nil {
+		return fmt.Errorf("FallbackCertNotBefore and FallbackCertNotAfter can't be used with FallbackCert")
+	}
+	if fallbackValidity {
+		// Check the dates the certificate will actually get, since either one
+		// may be left at its default.
+		notBefore, notAfter := c.FallbackCertNotBefore, c.FallbackCertNotAfter
+		if notBefore.IsZero() {
+			notBefore = time.Now().Add(-time.Hour)
+		}
+		if notAfter.IsZero() {
+			notAfter = time.Now().AddDate(1, 0, 0)
+		}
+		if notAfter.Before(notBefore) {
+			return fmt.Errorf("fallback certificate NotAfter %s is before its NotBefore %s",
+				notAfter, notBefore)
+		}
+	}
+	switch c.TLSALPNKeyType {
+	case TLSALPNKeyECDSA, TLSALPNKeyRSA2048, TLSALPNKeyRSA3072:
+	default:
+		return fmt.Errorf("unknown TLSALPNKeyType: %d", c.TLSALPNKeyType)
+	}
+	// If there is no configured log make a default with a prefix
+	if c.Log == nil {
+		c.Log = log.New(os.Stdout, "challtestsrv - ", log.LstdFlags)
+	}
+	// If there is no configured curve use P-256
+	if c.TLSALPNCurve == nil {
+		c.TLSALPNCurve = elliptic.P256()
+	}
+	if c.TLSALPNProtocol == "" {
+		c.TLSALPNProtocol = ACMETLS1Protocol
+	}
+	if c.TLSALPNStrictProtocol == nil {
+		strict := true
+		c.TLSALPNStrictProtocol = &strict
+	}
+	// If there are no configured TLS-ALPN-01 server timeouts use 5 seconds
+	if c.TLSALPNReadTimeout == 0 {
+		c.TLSALPNReadTimeout = 5 * time.Second
+	}
+	if c.TLSALPNWriteTimeout == 0 {
+		c.TLSALPNWriteTimeout = 5 * time.Second
+	}
+	if c.TLSALPNShutdownTimeout == 0 {
+		c.TLSALPNShutdownTimeout = 5 * time.Second
+	}
+	return nil
+}
+
+// New constructs and returns a new ChallSrv instance with the given Config,
+// modified by any given Options.
+func New(config Config, opts ...Option) (*ChallSrv, error) {
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	// Validate the provided configuration
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	metrics, err := newChallSrvMetrics(config.Stats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the configured fallback certificate if there is one. Otherwise issue
+	// one for this ChallSrv, with the requested validity window if any.
+	var fallbackCert tls.Certificate
+	switch {
+	case config.FallbackCert != nil:
+		fallbackCert = *config.FallbackCert
+	case !config.FallbackCertNotBefore.IsZero() || !config.FallbackCertNotAfter.IsZero():
+		fallbackCert, err = NewSelfSignedCert(config.TLSALPNCurve, func(template *x509.Certificate) {
+			if !config.FallbackCertNotBefore.IsZero() {
+				template.NotBefore = config.FallbackCertNotBefore
+			}
+			if !config.FallbackCertNotAfter.IsZero() {
+				template.NotAfter = config.FallbackCertNotAfter
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		fallbackCert = selfSignedCert(config.TLSALPNCurve)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	challSrv := &ChallSrv{
+		ctx:            ctx,
+		cancel:         cancel,
+		log:            config.Log,
+		tlsALPNLog:     config.TLSALPNLog,
+		metrics:        metrics,
+		fallbackCert:   fallbackCert,
+		stateFile:      config.ChallengeStateFile,
+		serversByKind:  make(map[serverKind][]challengeServer),
+		requestHistory: make(map[string]map[RequestEventType][]RequestEvent),
+		inFlight:       newInFlightTracker(),
+		httpOne:        make(map[string]string),
+		dnsOne:         make(map[string][]string),
+		tlsALPNOne:     make(map[string]string),
+		redirects:      make(map[string]string),
+
+		tlsALPNProtocol:       config.TLSALPNProtocol,
+		tlsALPNStrictProtocol: *config.TLSALPNStrictProtocol,
+		tlsALPNPerSource:      make(map[string]map[string]string),
+		tlsALPNRequestCounts:  make(map[string]int),
+		tlsALPNLastCerts:      make(map[string][]byte),
+		httpOneMocks: mockHTTPOneData{
+			statuses:     make(map[string]int),
+			locations:    make(map[string]string),
+			redirects:    make(map[string]httpOneRedirect),
+			delays:       make(map[string]time.Duration),
+			padding:      make(map[string]int),
+			resets:       make(map[string]bool),
+			contentTypes: make(map[string]string),
+		},
+		tlsALPNMocks: mockTLSALPNData{
+			serials:            make(map[string]*big.Int),
+			omitExtension:      make(map[string]bool),
+			extensionCritical:  make(map[string]bool),
+			badHash:            make(map[string]bool),
+			extraSANs:          make(map[string][]string),
+			delays:             make(map[string]time.Duration),
+			validity:           make(map[string]validityWindow),
+			failures:           make(map[string]error),
+			duplicateExtension: make(map[string]bool),
+			overrideCerts:      make(map[string]*tls.Certificate),
+			issuers:            make(map[string]tlsALPNIssuer),
+			intermediates:      make(map[string][]byte),
+			wrongSANs:          make(map[string]string),
+			flaky:              make(map[string]*flakyCounter),
+			rawHash:            make(map[string]bool),
+			extensionOIDs:      make(map[string]asn1.ObjectIdentifier),
+			badSignature:       make(map[string]bool),
+			isCA:               make(map[string]bool),
+			malformedDER:       make(map[string][]byte),
+			defaultCerts:       make(map[string]*tls.Certificate),
+			alerts:             make(map[string]TLSALPNAlert),
+		},
+		dnsMocks: mockDNSData{
+			defaultIPv4:     defaultIPv4,
+			defaultIPv6:     defaultIPv6,
+			aRecords:        make(map[string][]string),
+			aaaaRecords:     make(map[string][]string),
+			caaRecords:      make(map[string][]MockCAAPolicy),
+			cnameRecords:    make(map[string]string),
+			servFailRecords: make(map[string]bool),
+			ttls:            make(map[string]uint32),
+			errors:          make(map[string]int),
+			truncateRecords: make(map[string]bool),
+			tcpOnlyRecords:  make(map[string]bool),
+			answerNames:     make(map[string]string),
+			delays:          make(map[string]time.Duration),
+			soaRecords:      make(map[string]dns.SOA),
+
+			unknownTypeRcode: dns.RcodeNotImplemented,
+		},
+	}
+
+	if challSrv.stateFile != "" {
+		err := challSrv.LoadChallenges(challSrv.stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("loading challenge state: %w", err)
+		}
+	}
+
+	// If there are HTTP-01 addresses configured, create HTTP-01 servers with
+	// HTTPS disabled.
+	for _, address := range config.HTTPOneAddrs {
+		challSrv.log.Printf("Creating HTTP-01 challenge server on %s\n", address)
+		challSrv.addServer(httpOneServerKind, httpOneServer(address, challSrv, false, challSrv.fallbackCert))
+	}
+
+	// If there are HTTPS HTTP-01 addresses configured, create HTTP-01 servers
+	// with HTTPS enabled.
+	for _, address := range config.HTTPSOneAddrs {
+		challSrv.log.Printf("Creating HTTPS HTTP-01 challenge server on %s\n", address)
+		challSrv.addServer(httpsOneServerKind, httpOneServer(address, challSrv, true, challSrv.fallbackCert))
+	}
+
+	// If there are DNS-01 addresses configured, create DNS-01 servers
+	for _, address := range config.DNSOneAddrs {
+		challSrv.log.Printf("Creating TCP and UDP DNS-01 challenge server on %s\n", address)
+		challSrv.addServer(dnsOneServerKind, dnsOneServer(address, challSrv.dnsHandler))
+	}
+
+	// If there are DNS-over-HTTPS addresses configured, create DoH servers
+	for _, address := range config.DOHAddrs {
+		challSrv.log.Printf("Creating DNS-over-HTTPS server on %s\n", address)
+		challSrv.addServer(dohServerKind, dohServer(address, challSrv, challSrv.fallbackCert))
+	}
+
+	// If there are TLS-ALPN-01 addresses configured, create a TLS-ALPN-01 server
+	// listening on all of them.
+	if len(config.TLSALPNOneAddrs) > 0 {
+		challSrv.log.Printf("Creating TLS-ALPN-01 challenge server on %s\n",
+			strings.Join(config.TLSALPNOneAddrs, ", "))
+		key, err := newTLSALPNKey(config.TLSALPNKeyType, config.TLSALPNCurve)
+		if err != nil {
+			return nil, err
+		}
+		challSrv.tlsALPNKey = key
+		challSrv.addServer(tlsALPNServerKind, tlsALPNOneServer(challSrv, key, config))
+	}
+
+	// If there are gRPC addresses configured, create gRPC management servers
+	for _, address := range config.GRPCAddrs {
+		challSrv.log.Printf("Creating gRPC management server on %s\n", address)
+		challSrv.addServer(grpcServerKind, grpcServer(address, challSrv))
+	}
+
+	return challSrv, nil
+}
+
+// DeleteAllChallenges deletes all of the HTTP-01, DNS-01 and TLS-ALPN-01
+// challenges that have been added. Mock DNS data and HTTP redirects are not
+// affected.
+func (s *ChallSrv) DeleteAllChallenges() {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.httpOne = make(map[string]string)
+	s.dnsOne = make(map[string][]string)
+	s.deleteAllTLSALPNChallenges()
+}
+
+// Run starts each of the ChallSrv's challengeServers.
+func (s *ChallSrv) Run() {
+	s.log.Printf("Starting challenge servers")
+
+	// Start each server in their own dedicated Go routine
+	for _, srv := range s.servers {
+		go func(srv challengeServer) {
+			err := srv.ListenAndServe()
+			if err != nil && !strings.Contains(err.Error(), "Server closed") {
+				s.log.Print(err)
+			}
+		}(srv)
+	}
+}
+
+// Shutdown gracefully stops each of the ChallSrv's challengeServers. Requests
+// waiting out an injected delay are aborted rather than answered.
+func (s *ChallSrv) Shutdown() {
+	s.ShutdownWithReport()
+}
+
+// ShutdownWithReport is like Shutdown but also reports the requests that were
+// still in progress when it began, which are either waited for or cut off by
+// the shutdown. This is useful for diagnosing tests that race shutting down
+// against a client.
+func (s *ChallSrv) ShutdownWithReport() ShutdownReport {
+	report := ShutdownReport{Interrupted: s.inFlight.snapshot()}
+	s.cancel()
+	for _, srv := range s.servers {
+		if err := srv.Shutdown(); err != nil {
+			s.log.Printf("err in Shutdown(): %s\n", err.Error())
+		}
+	}
+	return report
+}
+
+// sleepContext waits for the given delay, returning false early if ctx is
+// done first.
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
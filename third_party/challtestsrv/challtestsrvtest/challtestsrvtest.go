@@ -0,0 +1,77 @@
+// Package challtestsrvtest provides a helper for running a challtestsrv
+// ChallSrv in Go tests. It is kept out of the challtestsrv package so that
+// programs using challtestsrv don't link in the testing package.
+package challtestsrvtest
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+)
+
+// testServerTimeout bounds how long NewTestServer waits for the servers to be
+// ready and how long its cleanup func waits for them to shut down.
+const testServerTimeout = 10 * time.Second
+
+// NewTestServer creates and runs a ChallSrv for use in tests. Any of the
+// config's HTTPOneAddrs, DNSOneAddrs and TLSALPNOneAddrs that are empty are set
+// to an ephemeral port on 127.0.0.1, and the config's Log defaults to
+// discarding output. The bound addresses can be found with HTTPOneAddr,
+// DNSOneAddr and TLSALPNOneAddr. NewTestServer fails the test if the servers
+// don't become ready.
+//
+// The returned cleanup func shuts the servers down, failing the test if that
+// takes too long. It is also registered with t.Cleanup, so calling it is only
+// needed to shut down before the end of the test; it is safe to call more than
+// once.
+func NewTestServer(t testing.TB, cfg challtestsrv.Config) (*challtestsrv.ChallSrv, func()) {
+	t.Helper()
+	ephemeral := []string{"127.0.0.1:0"}
+	if len(cfg.HTTPOneAddrs) == 0 {
+		cfg.HTTPOneAddrs = ephemeral
+	}
+	if len(cfg.DNSOneAddrs) == 0 {
+		cfg.DNSOneAddrs = ephemeral
+	}
+	if len(cfg.TLSALPNOneAddrs) == 0 {
+		cfg.TLSALPNOneAddrs = ephemeral
+	}
+	if cfg.Log == nil {
+		cfg.Log = log.New(io.Discard, "", 0)
+	}
+
+	srv, err := challtestsrv.New(cfg)
+	if err != nil {
+		t.Fatalf("creating challenge test server: %s", err)
+	}
+	srv.Run()
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			done := make(chan struct{})
+			go func() {
+				srv.Shutdown()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(testServerTimeout):
+				t.Errorf("challenge test server did not shut down within %s", testServerTimeout)
+			}
+		})
+	}
+	t.Cleanup(cleanup)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testServerTimeout)
+	defer cancel()
+	if err := srv.WaitReady(ctx); err != nil {
+		t.Fatalf("waiting for challenge test server: %s", err)
+	}
+	return srv, cleanup
+}
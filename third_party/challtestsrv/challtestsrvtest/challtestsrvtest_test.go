@@ -0,0 +1,107 @@
+package challtestsrvtest
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/miekg/dns"
+)
+
+func TestNewTestServer(t *testing.T) {
+	srv, cleanup := NewTestServer(t, challtestsrv.Config{})
+
+	for name, addr := range map[string]string{
+		"HTTP-01":     srv.HTTPOneAddr(),
+		"DNS-01":      srv.DNSOneAddr(),
+		"TLS-ALPN-01": srv.TLSALPNOneAddr(),
+	} {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Fatalf("%s address %q: %s", name, addr, err)
+		}
+		if host != "127.0.0.1" || port == "0" {
+			t.Errorf("%s address %q is not an ephemeral port on 127.0.0.1", name, addr)
+		}
+	}
+
+	cleanup()
+	// The cleanup func is also registered with t.Cleanup, so calling it again
+	// must be safe.
+	cleanup()
+	if conn, err := net.Dial("tcp", srv.HTTPOneAddr()); err == nil {
+		conn.Close()
+		t.Errorf("HTTP-01 server at %s still accepts connections after cleanup", srv.HTTPOneAddr())
+	}
+}
+
+// TestNewTestServerIsolation checks that two test servers in the same process
+// each answer from their own challenges.
+func TestNewTestServerIsolation(t *testing.T) {
+	a, _ := NewTestServer(t, challtestsrv.Config{})
+	b, _ := NewTestServer(t, challtestsrv.Config{})
+
+	const token = "token"
+	const txtName = "_acme-challenge.example.com."
+	const tlsHost = "a-only.example.com"
+	a.AddHTTPOneChallenge(token, "from-a")
+	b.AddHTTPOneChallenge(token, "from-b")
+	a.AddDNSOneChallenge(txtName, "from-a")
+	b.AddDNSOneChallenge(txtName, "from-b")
+	a.AddTLSALPNChallenge(tlsHost, "from-a")
+
+	testCases := []struct {
+		name        string
+		srv         *challtestsrv.ChallSrv
+		want        string
+		wantTLSALPN bool
+	}{
+		{name: "server a", srv: a, want: "from-a", wantTLSALPN: true},
+		{name: "server b", srv: b, want: "from-b", wantTLSALPN: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get("http://" + tc.srv.HTTPOneAddr() + "/.well-known/acme-challenge/" + token)
+			if err != nil {
+				t.Fatalf("getting HTTP-01 challenge: %s", err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("reading HTTP-01 challenge: %s", err)
+			}
+			if string(body) != tc.want {
+				t.Errorf("HTTP-01 challenge = %q, want %q", body, tc.want)
+			}
+
+			m := new(dns.Msg)
+			m.SetQuestion(txtName, dns.TypeTXT)
+			r, err := dns.Exchange(m, tc.srv.DNSOneAddr())
+			if err != nil {
+				t.Fatalf("querying DNS-01 challenge: %s", err)
+			}
+			if len(r.Answer) != 1 {
+				t.Fatalf("got %d TXT answers, want 1: %v", len(r.Answer), r.Answer)
+			}
+			if txt := r.Answer[0].(*dns.TXT).Txt; len(txt) != 1 || txt[0] != tc.want {
+				t.Errorf("DNS-01 challenge = %q, want %q", txt, tc.want)
+			}
+
+			_, err = tc.srv.TLSALPNHandshake(context.Background(), &tls.Config{
+				ServerName:         tlsHost,
+				NextProtos:         []string{challtestsrv.ACMETLS1Protocol},
+				InsecureSkipVerify: true,
+			})
+			if tc.wantTLSALPN && err != nil {
+				t.Errorf("TLS-ALPN-01 handshake failed: %s", err)
+			}
+			if !tc.wantTLSALPN && err == nil {
+				t.Errorf("TLS-ALPN-01 handshake for a challenge from another server succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package challtestsrv
+
+import (
+	"math/rand"
+)
+
+// chaosFailures holds the fraction and the source of the random failures set
+// with SetChaosFailureRate.
+type chaosFailures struct {
+	rate float64
+	rand *rand.Rand
+}
+
+// SetChaosFailureRate configures the chall srv to fail the given fraction of
+// all HTTP-01, DNS-01 and TLS-ALPN-01 challenge requests, chosen at random,
+// with a transient error: a 503 for HTTP-01 requests, a SERVFAIL for DNS
+// questions and a failed handshake for acme-tls/1 handshakes. Failures are
+// drawn from a source seeded with seed, so the same seed fails the same
+// requests of the same sequence of requests. This is useful for testing that
+// a validator's retries eventually succeed against a flaky server. Requests
+// failed this way are still recorded and reported to challenge callbacks with
+// a "chaos-failure" outcome. A rate of 1 or more fails every request; use
+// a zero rate to stop failing requests.
+func (s *ChallSrv) SetChaosFailureRate(rate float64, seed int64) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if rate <= 0 {
+		s.chaos = nil
+		return
+	}
+	s.chaos = &chaosFailures{
+		rate: rate,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// chaosFailure returns true if the current challenge request should fail
+// because of SetChaosFailureRate.
+func (s *ChallSrv) chaosFailure() bool {
+	// The source is advanced so the write lock is needed.
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if s.chaos == nil {
+		return false
+	}
+	return s.chaos.rand.Float64() < s.chaos.rate
+}
@@ -0,0 +1,82 @@
+package challtestsrv_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestChaosFailureRate(t *testing.T) {
+	const name = "_acme-challenge.chaos.example.com."
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", "http")
+	srv.AddDNSOneChallenge(name, "dns")
+	srv.AddTLSALPNChallenge("chaos.example.com", "tls")
+
+	testCases := []struct {
+		name     string
+		rate     float64
+		wantFail bool
+	}{
+		{name: "every request", rate: 1, wantFail: true},
+		{name: "more than every request", rate: 2, wantFail: true},
+		{name: "disabled", rate: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.SetChaosFailureRate(tc.rate, 1)
+
+			wantStatus := http.StatusOK
+			if tc.wantFail {
+				wantStatus = http.StatusServiceUnavailable
+			}
+			if resp, _ := getHTTPOne(t, srv, "token"); resp.StatusCode != wantStatus {
+				t.Errorf("HTTP-01 status = %d, want %d", resp.StatusCode, wantStatus)
+			}
+
+			wantRcode := dns.RcodeSuccess
+			if tc.wantFail {
+				wantRcode = dns.RcodeServerFailure
+			}
+			if r := queryDNS(t, srv, "udp", name, dns.TypeTXT); r.Rcode != wantRcode {
+				t.Errorf("DNS-01 rcode = %s, want %s", dns.RcodeToString[r.Rcode], dns.RcodeToString[wantRcode])
+			}
+
+			_, err := handshakeTLSALPN(srv, "chaos.example.com")
+			if tc.wantFail && err == nil {
+				t.Error("TLS-ALPN-01 handshake succeeded, want a failure")
+			}
+			if !tc.wantFail && err != nil {
+				t.Errorf("TLS-ALPN-01 handshake failed: %s", err)
+			}
+		})
+	}
+
+	// The same seed fails the same requests.
+	failures := func(seed int64) []bool {
+		srv.SetChaosFailureRate(0.5, seed)
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			resp, _ := getHTTPOne(t, srv, "token")
+			failed = append(failed, resp.StatusCode == http.StatusServiceUnavailable)
+		}
+		return failed
+	}
+	first := failures(42)
+	if second := failures(42); !reflect.DeepEqual(first, second) {
+		t.Errorf("seed 42 failed requests %v, then %v", first, second)
+	}
+	var failed int
+	for _, f := range first {
+		if f {
+			failed++
+		}
+	}
+	if failed == 0 || failed == len(first) {
+		t.Errorf("rate 0.5 failed %d of %d requests, want some but not all", failed, len(first))
+	}
+}
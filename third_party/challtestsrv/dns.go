@@ -0,0 +1,421 @@
+package challtestsrv
+
+import (
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// maxDNSRequests is the number of DNS queries remembered for DNSRequests.
+const maxDNSRequests = 100
+
+// DNSRequest describes a single DNS question received by a dnsOneServer.
+type DNSRequest struct {
+	// Name from the DNS question.
+	Name string
+	// Qtype from the DNS question, e.g. dns.TypeCAA.
+	Qtype uint16
+	// Transport the query was received over, one of "udp", "tcp" or "https".
+	Transport string
+}
+
+// addDNSRequest records a DNS question received over the given transport in
+// the DNS request ring buffer.
+func (s *ChallSrv) addDNSRequest(q dns.Question, transport string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if len(s.dnsRequests) >= maxDNSRequests {
+		s.dnsRequests = s.dnsRequests[1:]
+	}
+	s.dnsRequests = append(s.dnsRequests, DNSRequest{
+		Name:      q.Name,
+		Qtype:     q.Qtype,
+		Transport: transport,
+	})
+}
+
+// DNSRequests returns the most recent DNS questions received by the server,
+// oldest first. This is useful for asserting which names and types a resolver
+// queried, and in what order.
+func (s *ChallSrv) DNSRequests() []DNSRequest {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	requests := make([]DNSRequest, len(s.dnsRequests))
+	copy(requests, s.dnsRequests)
+	return requests
+}
+
+// mockSOA returns a mock DNS SOA record with fake data.
+func mockSOA() *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   "challtestsrv.invalid.",
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+		},
+		Ns:      "ns.challtestsrv.invalid.",
+		Mbox:    "master.challtestsrv.invalid.",
+		Serial:  1,
+		Refresh: 1,
+		Retry:   1,
+		Expire:  1,
+		Minttl:  1,
+	}
+}
+
+// dnsAnswerFunc is a function that accepts a DNS question and returns one or
+// more RRs for the response.
+type dnsAnswerFunc func(question dns.Question) []dns.RR
+
+// cnameAnswers is a dnsAnswerFunc that creates CNAME RR's for the given question
+// using the ChallSrv's dns mock data. If there is no mock CNAME data for the
+// given hostname in the question no RR's will be returned.
+func (s *ChallSrv) cnameAnswers(q dns.Question) []dns.RR {
+	var records []dns.RR
+	ttl := s.GetDNSRecordTTL(q.Name)
+
+	if value := s.GetDNSCNAMERecord(q.Name); value != "" {
+		record := &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Target: value,
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// txtAnswers is a dnsAnswerFunc that creates TXT RR's for the given question
+// using the ChallSrv's dns mock data. If there is no mock TXT data for the
+// given hostname in the question no RR's will be returned. Each value added for
+// the hostname is returned as its own RR, split with splitTXT if it is longer
+// than a single character-string allows.
+func (s *ChallSrv) txtAnswers(q dns.Question) []dns.RR {
+	var records []dns.RR
+	ttl := s.GetDNSRecordTTL(q.Name)
+	values := s.GetDNSOneChallenge(q.Name)
+	for _, resp := range values {
+		record := &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Txt: splitTXT(resp),
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// maxTXTStringLen is the maximum length of a single character-string in a TXT
+// record's RDATA. See RFC 1035 section 3.3.
+const maxTXTStringLen = 255
+
+// splitTXT splits a TXT record value into character-strings of at most
+// maxTXTStringLen bytes, so values longer than that are served as a single
+// record with multiple strings that clients concatenate.
+func splitTXT(value string) []string {
+	var strs []string
+	for len(value) > maxTXTStringLen {
+		strs = append(strs, value[:maxTXTStringLen])
+		value = value[maxTXTStringLen:]
+	}
+	return append(strs, value)
+}
+
+// aAnswers is a dnsAnswerFunc that creates A RR's for the given question using
+// the ChallSrv's dns mock data. If there is not a mock ipv4 A response added
+// for the given hostname in the question the default IPv4 address will be used
+// for the response.
+func (s *ChallSrv) aAnswers(q dns.Question) []dns.RR {
+	var records []dns.RR
+	// Don't answer any questions for IP addresses with a fakeDNS response.
+	// These queries are invalid!
+	if ip := net.ParseIP(q.Name); ip != nil {
+		return records
+	}
+	ttl := s.GetDNSRecordTTL(q.Name)
+	values := s.GetDNSARecord(q.Name)
+	if defaultIPv4 := s.GetDefaultDNSIPv4(); len(values) == 0 && defaultIPv4 != "" {
+		values = []string{defaultIPv4}
+	}
+	for _, resp := range values {
+		ipAddr := net.ParseIP(resp)
+		if ipAddr == nil || ipAddr.To4() == nil {
+			// If the mock data isn't a valid IPv4 address, don't use it.
+			continue
+		}
+		record := &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			A: ipAddr,
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// aaaaAnswers is a dnsAnswerFunc that creates AAAA RR's for the given question
+// using the ChallSrv's dns mock data. If there is not a mock IPv6 AAAA response
+// added for the given hostname in the question the default IPv6 address will be
+// used for the response.
+func (s *ChallSrv) aaaaAnswers(q dns.Question) []dns.RR {
+	var records []dns.RR
+	ttl := s.GetDNSRecordTTL(q.Name)
+	values := s.GetDNSAAAARecord(q.Name)
+	if defaultIPv6 := s.GetDefaultDNSIPv6(); len(values) == 0 && defaultIPv6 != "" {
+		values = []string{defaultIPv6}
+	}
+	for _, resp := range values {
+		ipAddr := net.ParseIP(resp)
+		if ipAddr == nil || ipAddr.To4() != nil {
+			// If the mock data isn't a valid IPv6 address, don't use it.
+			continue
+		}
+		record := &dns.AAAA{
+			Hdr: dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypeAAAA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			AAAA: ipAddr,
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// caaAnswers is a dnsAnswerFunc that creates CAA RR's for the given question
+// using the ChallSrv's dns mock data. If there is not a mock CAA response
+// added for the given hostname in the question no RRs will be returned, and the
+// query is answered with NODATA. Policies are never inherited from parent
+// names, leaving the CAA tree walk to the client.
+func (s *ChallSrv) caaAnswers(q dns.Question) []dns.RR {
+	var records []dns.RR
+	ttl := s.GetDNSRecordTTL(q.Name)
+	values := s.GetDNSCAARecord(q.Name)
+	for _, resp := range values {
+		record := &dns.CAA{
+			Hdr: dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypeCAA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Flag:  resp.Flag,
+			Tag:   resp.Tag,
+			Value: resp.Value,
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// dnsOutcome describes how the DNS-01 challenge server answered a question.
+type dnsOutcome string
+
+const (
+	// dnsAnswered means one or more records were returned for the question.
+	dnsAnswered dnsOutcome = "answered"
+	// dnsNoAnswer means there was no mock data for the question.
+	dnsNoAnswer dnsOutcome = "no-answer"
+	// dnsForcedError means a SERVFAIL or SetDNSError mock was used for the
+	// question instead of answering it.
+	dnsForcedError dnsOutcome = "forced-error"
+	// dnsTruncated means an empty, truncated UDP response was used for the
+	// question because of a SetDNSTruncate mock.
+	dnsTruncated dnsOutcome = "truncated"
+	// dnsRefusedUDP means a UDP query was refused because of a SetDNSTCPOnly
+	// mock.
+	dnsRefusedUDP dnsOutcome = "refused-udp"
+	// dnsAborted means the query was abandoned during a SetDNSDelay delay,
+	// e.g. because the server shut down or the DoH client went away.
+	dnsAborted dnsOutcome = "aborted"
+	// dnsChaosFailure means the SERVFAIL rcode was set because of
+	// SetChaosFailureRate.
+	dnsChaosFailure dnsOutcome = "chaos-failure"
+	// dnsNotImplemented means the question's type isn't supported.
+	dnsNotImplemented dnsOutcome = "not-implemented"
+)
+
+// anyAnswers is a dnsAnswerFunc that answers ANY queries with a single
+// synthesized HINFO RR as described in RFC 8482 section 4.2, rather than with
+// every record for the given hostname in the question.
+func (s *ChallSrv) anyAnswers(q dns.Question) []dns.RR {
+	return []dns.RR{&dns.HINFO{
+		Hdr: dns.RR_Header{
+			Name:   q.Name,
+			Rrtype: dns.TypeHINFO,
+			Class:  dns.ClassINET,
+			Ttl:    s.GetDNSRecordTTL(q.Name),
+		},
+		Cpu: "RFC8482",
+	}}
+}
+
+// noAnswers is a dnsAnswerFunc that never returns any RRs, giving an empty
+// NOERROR response.
+func noAnswers(q dns.Question) []dns.RR {
+	return nil
+}
+
+// dnsHandler is a miekg/dns handler that can process a dns.Msg request and
+// write a response to the provided dns.ResponseWriter. TXT, A, AAAA, CNAME,
+// and CAA queries types are supported and answered using the ChallSrv's mock
+// DNS data. A host that is aliased by a CNAME record will follow that alias
+// one level and return the requested record types for that alias' target.
+// ANY queries are answered as described in RFC 8482 and HINFO queries get an
+// empty answer. Other types get the rcode set with SetDNSUnknownTypeRcode.
+func (s *ChallSrv) dnsHandler(w dns.ResponseWriter, r *dns.Msg) {
+	s.serveDNS(s.ctx, w, r)
+}
+
+// serveDNS answers the request r as described for dnsHandler. If ctx is done
+// while waiting out a SetDNSDelay or SetDNSJitter delay no reply is written.
+// For plain UDP and TCP queries ctx is only done once the server shuts down,
+// since miekg/dns gives handlers no way to learn that the client went away.
+func (s *ChallSrv) serveDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Compress = false
+	transport := w.RemoteAddr().Network()
+	udp := transport == "udp"
+	// DNS-over-HTTPS requests are already tracked by their HTTP connection.
+	if transport != "https" {
+		defer s.inFlight.start(w.LocalAddr())()
+	}
+
+	// For each question, add answers based on the type of question
+	for _, q := range r.Question {
+		s.AddRequestEvent(DNSRequestEvent{
+			Question: q,
+		})
+		s.metrics.dnsQueries.WithLabelValues(dns.TypeToString[q.Qtype]).Inc()
+		s.addDNSRequest(q, transport)
+
+		if delay := s.GetDNSDelay(q.Name) + s.nextDNSJitter(); delay > 0 && !sleepContext(ctx, delay) {
+			s.notifyChallenge(ChallengeEvent{
+				Type:       DNSRequestEventType,
+				Identifier: q.Name,
+				Outcome:    string(dnsAborted),
+			}, false)
+			return
+		}
+
+		outcome := s.answerDNSQuestion(m, r, q, udp)
+		s.notifyChallenge(ChallengeEvent{
+			Type:       DNSRequestEventType,
+			Identifier: q.Name,
+			Outcome:    string(outcome),
+		}, q.Qtype == dns.TypeTXT && outcome == dnsAnswered)
+		if outcome == dnsNotImplemented {
+			break
+		}
+	}
+
+	soa := mockSOA()
+	if len(r.Question) > 0 {
+		if zoneSOA, found := s.GetDNSSOA(r.Question[0].Name); found {
+			soa = zoneSOA
+		}
+	}
+	m.Ns = append(m.Ns, soa)
+	_ = w.WriteMsg(m)
+}
+
+// answerDNSQuestion adds the answers for a single question of the request r to
+// the reply m, using the ChallSrv's mock DNS data, and describes how the
+// question was answered.
+func (s *ChallSrv) answerDNSQuestion(m, r *dns.Msg, q dns.Question, udp bool) dnsOutcome {
+	if s.chaosFailure() {
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return dnsChaosFailure
+	}
+	// If there is a ServFail mock set then ignore the question and set the
+	// SERVFAIL rcode.
+	if s.GetDNSServFailRecord(q.Name) {
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return dnsForcedError
+	}
+
+	// If an error rcode mock is set then likewise ignore the question and set
+	// the configured rcode.
+	if rcode := s.GetDNSError(q.Name); rcode != dns.RcodeSuccess {
+		m.SetRcode(r, rcode)
+		return dnsForcedError
+	}
+
+	// If a truncate mock is set and the query came in over UDP then set the
+	// TC bit without answering so the client retries over TCP.
+	if udp && s.GetDNSTruncate(q.Name) {
+		m.Truncated = true
+		return dnsTruncated
+	}
+
+	// If a TCP only mock is set and the query came in over UDP then refuse it
+	// without setting the TC bit, leaving it to the client to try TCP.
+	if udp && s.GetDNSTCPOnly(q.Name) {
+		m.SetRcode(r, dns.RcodeRefused)
+		return dnsRefusedUDP
+	}
+
+	outcome := dnsNoAnswer
+
+	// If a CNAME exists for the question include the CNAME record and modify
+	// the question to instead lookup based on that CNAME's target
+	if cname := s.GetDNSCNAMERecord(q.Name); cname != "" {
+		cnameRecords := s.cnameAnswers(q)
+		m.Answer = append(m.Answer, cnameRecords...)
+		outcome = dnsAnswered
+
+		q = dns.Question{Name: cname, Qtype: q.Qtype}
+	}
+
+	var answerFunc dnsAnswerFunc
+	switch q.Qtype {
+	case dns.TypeCNAME:
+		answerFunc = s.cnameAnswers
+	case dns.TypeTXT:
+		answerFunc = s.txtAnswers
+	case dns.TypeA:
+		answerFunc = s.aAnswers
+	case dns.TypeAAAA:
+		answerFunc = s.aaaaAnswers
+	case dns.TypeCAA:
+		answerFunc = s.caaAnswers
+	case dns.TypeANY:
+		answerFunc = s.anyAnswers
+	case dns.TypeHINFO:
+		answerFunc = noAnswers
+	default:
+		m.SetRcode(r, s.GetDNSUnknownTypeRcode())
+		return dnsNotImplemented
+	}
+
+	if records := answerFunc(q); len(records) > 0 {
+		// If an answer name mock is set then use it as the owner name of the
+		// records instead of the queried name.
+		if owner := s.GetDNSAnswerName(q.Name); owner != "" {
+			for _, record := range records {
+				record.Header().Name = owner
+			}
+		}
+		m.Answer = append(m.Answer, records...)
+		outcome = dnsAnswered
+	}
+	return outcome
+}
@@ -0,0 +1,180 @@
+package challtestsrv_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestLongTXTValuesSplit(t *testing.T) {
+	testCases := []struct {
+		length      int
+		wantStrings int
+	}{
+		{length: 1, wantStrings: 1},
+		{length: 254, wantStrings: 1},
+		{length: 255, wantStrings: 1},
+		{length: 256, wantStrings: 2},
+		{length: 299, wantStrings: 2},
+		{length: 300, wantStrings: 2},
+		{length: 301, wantStrings: 2},
+		{length: 510, wantStrings: 2},
+		{length: 511, wantStrings: 3},
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d bytes", tc.length), func(t *testing.T) {
+			name := fmt.Sprintf("_acme-challenge.txt-%d.example.com.", tc.length)
+			value := strings.Repeat("a", tc.length)
+			srv.AddDNSOneChallenge(name, value)
+
+			// Long values don't fit in a UDP response.
+			r := queryDNS(t, srv, "tcp", name, dns.TypeTXT)
+			if len(r.Answer) != 1 {
+				t.Fatalf("got %d TXT records, want 1: %v", len(r.Answer), r.Answer)
+			}
+			strs := r.Answer[0].(*dns.TXT).Txt
+			if len(strs) != tc.wantStrings {
+				t.Errorf("got %d character-strings, want %d", len(strs), tc.wantStrings)
+			}
+			for i, s := range strs {
+				if len(s) > 255 {
+					t.Errorf("character-string %d is %d bytes long", i, len(s))
+				}
+			}
+			if got := strings.Join(strs, ""); got != value {
+				t.Errorf("character-strings join to %d bytes, want the %d byte value", len(got), len(value))
+			}
+		})
+	}
+}
+
+func TestUncommonQueryTypes(t *testing.T) {
+	testCases := []struct {
+		name             string
+		qtype            uint16
+		unknownTypeRcode int
+		wantRcode        int
+		wantHINFO        bool
+	}{
+		{name: "ANY", qtype: dns.TypeANY, wantRcode: dns.RcodeSuccess, wantHINFO: true},
+		{name: "HINFO", qtype: dns.TypeHINFO, wantRcode: dns.RcodeSuccess},
+		{name: "unknown type", qtype: dns.TypeNAPTR, wantRcode: dns.RcodeNotImplemented},
+		{
+			name:             "unknown type with rcode set",
+			qtype:            dns.TypeNAPTR,
+			unknownTypeRcode: dns.RcodeRefused,
+			wantRcode:        dns.RcodeRefused,
+		},
+		{
+			// ANY is answered whatever rcode is set for unknown types.
+			name:             "ANY with rcode set",
+			qtype:            dns.TypeANY,
+			unknownTypeRcode: dns.RcodeRefused,
+			wantRcode:        dns.RcodeSuccess,
+			wantHINFO:        true,
+		},
+	}
+	for _, tc := range testCases {
+		for _, network := range []string{"udp", "tcp"} {
+			t.Run(tc.name+" over "+network, func(t *testing.T) {
+				srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+				if tc.unknownTypeRcode != 0 {
+					srv.SetDNSUnknownTypeRcode(tc.unknownTypeRcode)
+				}
+
+				r := queryDNS(t, srv, network, "example.com", tc.qtype)
+				if r.Rcode != tc.wantRcode {
+					t.Errorf("rcode = %s, want %s", dns.RcodeToString[r.Rcode], dns.RcodeToString[tc.wantRcode])
+				}
+				wantAnswers := 0
+				if tc.wantHINFO {
+					wantAnswers = 1
+				}
+				if len(r.Answer) != wantAnswers {
+					t.Fatalf("got %d answers, want %d: %v", len(r.Answer), wantAnswers, r.Answer)
+				}
+				if tc.wantHINFO {
+					if hinfo, ok := r.Answer[0].(*dns.HINFO); !ok || hinfo.Cpu != "RFC8482" {
+						t.Errorf("answer %v is not the RFC 8482 HINFO record", r.Answer[0])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDNSTCPOnly(t *testing.T) {
+	const name = "_acme-challenge.tcp-only.example.com."
+
+	testCases := []struct {
+		name        string
+		tcpOnly     bool
+		network     string
+		wantRcode   int
+		wantAnswers bool
+	}{
+		{name: "UDP refused", tcpOnly: true, network: "udp", wantRcode: dns.RcodeRefused},
+		{name: "TCP answered", tcpOnly: true, network: "tcp", wantRcode: dns.RcodeSuccess, wantAnswers: true},
+		{name: "UDP answered once removed", tcpOnly: false, network: "udp", wantRcode: dns.RcodeSuccess, wantAnswers: true},
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSOneChallenge(name, "tcp-only")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.SetDNSTCPOnly(name, tc.tcpOnly)
+
+			r := queryDNS(t, srv, tc.network, name, dns.TypeTXT)
+			if r.Rcode != tc.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[r.Rcode], dns.RcodeToString[tc.wantRcode])
+			}
+			// The TC bit isn't set, so a client only retries over TCP if it
+			// does so on its own.
+			if r.Truncated {
+				t.Error("response has the TC bit set")
+			}
+			got := txtValues(r.Answer)
+			if tc.wantAnswers && !reflect.DeepEqual(got, []string{"tcp-only"}) {
+				t.Errorf("got TXT values %q, want [\"tcp-only\"]", got)
+			}
+			if !tc.wantAnswers && len(got) != 0 {
+				t.Errorf("got TXT values %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestDNSRequests(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	queryDNS(t, srv, "udp", "example.com", dns.TypeCAA)
+	queryDNS(t, srv, "tcp", "_acme-challenge.example.com", dns.TypeTXT)
+	queryDNS(t, srv, "udp", "www.example.com", dns.TypeA)
+
+	want := []challtestsrv.DNSRequest{
+		{Name: "example.com.", Qtype: dns.TypeCAA, Transport: "udp"},
+		{Name: "_acme-challenge.example.com.", Qtype: dns.TypeTXT, Transport: "tcp"},
+		{Name: "www.example.com.", Qtype: dns.TypeA, Transport: "udp"},
+	}
+	if got := srv.DNSRequests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DNSRequests() = %+v, want %+v", got, want)
+	}
+
+	// Only the most recent questions are kept.
+	for i := 0; i < 100; i++ {
+		queryDNS(t, srv, "udp", fmt.Sprintf("q%d.example.com", i), dns.TypeA)
+	}
+	got := srv.DNSRequests()
+	if len(got) != 100 {
+		t.Fatalf("got %d DNSRequests after 103 queries, want 100", len(got))
+	}
+	if got[0].Name != "q0.example.com." || got[99].Name != "q99.example.com." {
+		t.Errorf("DNSRequests() runs from %q to %q, want q0 to q99", got[0].Name, got[99].Name)
+	}
+}
@@ -0,0 +1,145 @@
+package challtestsrv
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// AddDNSOneChallenge adds a TXT record for the given host with the given
+// content. Existing TXT records for the host are kept, so calling it more than
+// once for the same host results in all of the values being returned in
+// a single response. Use DeleteDNSOneChallenge to remove them all.
+func (s *ChallSrv) AddDNSOneChallenge(host, content string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.dnsOne[host] = append(s.dnsOne[host], content)
+}
+
+// AddDNSOneChallenges adds TXT records for the hosts in the given map of host
+// to contents, like calling AddDNSOneChallenge for each value but taking the
+// challenge lock only once.
+func (s *ChallSrv) AddDNSOneChallenges(challenges map[string][]string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	for host, contents := range challenges {
+		s.dnsOne[host] = append(s.dnsOne[host], contents...)
+	}
+}
+
+// AddWildcardDNSOneChallenge adds a TXT record with the given content for the
+// DNS-01 challenge of a wildcard identifier for baseDomain. As with any DNS-01
+// challenge the record is served at "_acme-challenge.<baseDomain>." and
+// a leading "*." on baseDomain is ignored, so both "example.com" and
+// "*.example.com" can be passed. Use DeleteDNSOneChallenge with the
+// "_acme-challenge" name to remove it.
+func (s *ChallSrv) AddWildcardDNSOneChallenge(baseDomain, content string) {
+	baseDomain = strings.TrimPrefix(baseDomain, "*.")
+	s.AddDNSOneChallenge("_acme-challenge."+dns.Fqdn(baseDomain), content)
+}
+
+// DeleteDNSOneChallenge deletes a TXT record for the given host.
+func (s *ChallSrv) DeleteDNSOneChallenge(host string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	delete(s.dnsOne, host)
+}
+
+// GetDNSOneChallenge returns a slice of TXT record values for the given host.
+// If the host does not exist in the challenge response data then nil is
+// returned.
+func (s *ChallSrv) GetDNSOneChallenge(host string) []string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	if values := s.dnsOne[host]; values != nil {
+		// Return a copy so callers can't race with AddDNSOneChallenge appending
+		// to the same backing array.
+		return append([]string(nil), values...)
+	}
+	return nil
+}
+
+type dnsHandler func(dns.ResponseWriter, *dns.Msg)
+
+// challDNSServer is a DNS-01 challenge server made up of a UDP and a TCP
+// `dns.Server` bound to the same address and port. It implements the
+// challengeServer interface.
+type challDNSServer struct {
+	address string
+	udp     *dns.Server
+	tcp     *dns.Server
+	bound   *boundAddrs
+}
+
+// ListenAndServe for a challDNSServer binds the UDP listener first and then
+// binds the TCP listener to the same port, so that both share a port even when
+// the server's address has port 0. It blocks until both servers have stopped
+// and returns the first error, if any.
+func (c challDNSServer) ListenAndServe() error {
+	pc, err := net.ListenPacket("udp", c.address)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		_ = pc.Close()
+		return err
+	}
+	c.bound.add(pc.LocalAddr())
+	c.udp.PacketConn = pc
+	c.tcp.Listener = l
+
+	errs := make(chan error, 2)
+	go func() { errs <- c.udp.ActivateAndServe() }()
+	go func() { errs <- c.tcp.ActivateAndServe() }()
+	firstErr := <-errs
+	if err := <-errs; firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+func (c challDNSServer) Shutdown() error {
+	udpErr := c.udp.Shutdown()
+	if err := c.tcp.Shutdown(); err != nil {
+		return err
+	}
+	return udpErr
+}
+
+func (c challDNSServer) Addrs() []string {
+	return c.bound.list()
+}
+
+// dnsOneServer creates an ACME DNS-01 challenge server. The provided dns
+// handler handles the DNS requests of both the UDP and the TCP listener of the
+// returned server. It is set on each `dns.Server` rather than registered with
+// the `miekg/dns` package's global mux so that every ChallSrv in a process
+// answers from its own mock data.
+func dnsOneServer(address string, handler dnsHandler) challengeServer {
+	// Create a UDP DNS server
+	udpServer := &dns.Server{
+		Net:          "udp",
+		Handler:      dns.HandlerFunc(handler),
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+	// Create a TCP DNS server
+	tcpServer := &dns.Server{
+		Net:          "tcp",
+		Handler:      dns.HandlerFunc(handler),
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+	return challDNSServer{
+		address: address,
+		udp:     udpServer,
+		tcp:     tcpServer,
+		bound:   &boundAddrs{},
+	}
+}
@@ -0,0 +1,39 @@
+package challtestsrv_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestAddWildcardDNSOneChallenge(t *testing.T) {
+	testCases := []struct {
+		name       string
+		baseDomain string
+	}{
+		{name: "base domain", baseDomain: "example.com"},
+		{name: "wildcard name", baseDomain: "*.example.com"},
+		{name: "fully qualified", baseDomain: "example.com."},
+		{name: "fully qualified wildcard name", baseDomain: "*.example.com."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			srv.AddWildcardDNSOneChallenge(tc.baseDomain, "wildcard")
+
+			// A validator checks the DNS-01 challenge of *.example.com at the
+			// same name as the one of example.com.
+			r := queryDNS(t, srv, "udp", "_acme-challenge.example.com", dns.TypeTXT)
+			if got := txtValues(r.Answer); !reflect.DeepEqual(got, []string{"wildcard"}) {
+				t.Errorf("got TXT values %q, want [\"wildcard\"]", got)
+			}
+			r = queryDNS(t, srv, "udp", "_acme-challenge.*.example.com", dns.TypeTXT)
+			if got := txtValues(r.Answer); len(got) != 0 {
+				t.Errorf("got TXT values %q for _acme-challenge.*.example.com, want none", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package challtestsrv
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dohPath is the URL path DNS-over-HTTPS queries are served on. See
+	// https://datatracker.ietf.org/doc/html/rfc8484#section-4.1
+	dohPath = "/dns-query"
+	// dohContentType is the media type of DNS-over-HTTPS requests and responses.
+	dohContentType = "application/dns-message"
+)
+
+// dohAddr is a net.Addr for the client of a DNS-over-HTTPS request. It reports
+// "https" as its network so DNS-over-HTTPS queries can be told apart from UDP
+// and TCP queries in DNSRequests.
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
+
+// dohResponseWriter is a dns.ResponseWriter that captures the reply written by
+// a dnsHandler so it can be returned in a DNS-over-HTTPS response.
+type dohResponseWriter struct {
+	local  net.Addr
+	remote net.Addr
+	reply  *dns.Msg
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr  { return w.local }
+func (w *dohResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.reply = m
+	return nil
+}
+
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.reply = m
+	return len(b), nil
+}
+
+func (w *dohResponseWriter) Close() error        { return nil }
+func (w *dohResponseWriter) TsigStatus() error   { return nil }
+func (w *dohResponseWriter) TsigTimersOnly(bool) {}
+func (w *dohResponseWriter) Hijack()             {}
+
+// readDOHQuery extracts the wire format DNS query from a DNS-over-HTTPS GET or
+// POST request.
+func readDOHQuery(r *http.Request) ([]byte, int, error) {
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			return nil, http.StatusBadRequest, errors.New("missing dns query parameter")
+		}
+		query, err := base64.RawURLEncoding.DecodeString(param)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return query, 0, nil
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohContentType {
+			return nil, http.StatusUnsupportedMediaType, errors.New("unsupported content type")
+		}
+		query, err := io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return query, 0, nil
+	default:
+		return nil, http.StatusMethodNotAllowed, errors.New("method not allowed")
+	}
+}
+
+// serveDOH answers a DNS-over-HTTPS request using the same dnsHandler as the
+// UDP and TCP DNS-01 servers.
+func (s *ChallSrv) serveDOH(w http.ResponseWriter, r *http.Request) {
+	query, status, err := readDOHQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	m := new(dns.Msg)
+	if err := m.Unpack(query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	rw := &dohResponseWriter{
+		local:  local,
+		remote: dohAddr(r.RemoteAddr),
+	}
+	s.serveDNS(r.Context(), rw, m)
+	if r.Context().Err() != nil {
+		// The client went away or the server is shutting down.
+		return
+	}
+	if rw.reply == nil {
+		http.Error(w, "no DNS reply", http.StatusInternalServerError)
+		return
+	}
+	resp, err := rw.reply.Pack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", dohContentType)
+	_, _ = w.Write(resp)
+}
+
+// dohServer creates a DNS-over-HTTPS (RFC 8484) server answering queries on
+// dohPath from the ChallSrv's DNS mock data. It uses the provided self-signed
+// certificate.
+func dohServer(address string, challSrv *ChallSrv, fallbackCert tls.Certificate) challengeServer {
+	mux := http.NewServeMux()
+	mux.HandleFunc(dohPath, challSrv.serveDOH)
+	srv := &http.Server{
+		Addr:         address,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{fallbackCert},
+		},
+	}
+	return challHTTPServer{srv, &boundAddrs{}}
+}
@@ -0,0 +1,101 @@
+package challtestsrv_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestDOH(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		DOHAddrs: []string{"127.0.0.1:0"},
+	})
+	srv.AddDNSOneChallenge("_acme-challenge.doh.example.com.", "doh")
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	url := "https://" + srv.DOHAddr() + "/dns-query"
+
+	query := new(dns.Msg)
+	query.SetQuestion("_acme-challenge.doh.example.com.", dns.TypeTXT)
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatalf("packing query: %s", err)
+	}
+
+	testCases := []struct {
+		name string
+		req  func() (*http.Request, error)
+	}{
+		{
+			name: "GET",
+			req: func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, url+"?dns="+base64.RawURLEncoding.EncodeToString(packed), nil)
+			},
+		},
+		{
+			name: "POST",
+			req: func() (*http.Request, error) {
+				req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(packed))
+				if err == nil {
+					req.Header.Set("Content-Type", "application/dns-message")
+				}
+				return req, err
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := tc.req()
+			if err != nil {
+				t.Fatalf("building request: %s", err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("DoH request failed: %s", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/dns-message" {
+				t.Errorf("Content-Type = %q, want %q", ct, "application/dns-message")
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading response: %s", err)
+			}
+			r := new(dns.Msg)
+			if err := r.Unpack(body); err != nil {
+				t.Fatalf("unpacking response: %s", err)
+			}
+			if got := txtValues(r.Answer); !reflect.DeepEqual(got, []string{"doh"}) {
+				t.Errorf("got TXT values %q, want [\"doh\"]", got)
+			}
+		})
+	}
+
+	// POSTs must use the DNS message media type.
+	resp, err := client.Post(url, "text/plain", bytes.NewReader(packed))
+	if err != nil {
+		t.Fatalf("DoH request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("POST with text/plain: status = %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+
+	for _, req := range srv.DNSRequests() {
+		if req.Transport != "https" {
+			t.Errorf("DoH query recorded with transport %q, want \"https\"", req.Transport)
+		}
+	}
+}
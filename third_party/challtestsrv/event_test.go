@@ -0,0 +1,76 @@
+package challtestsrv_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+// TestHTTPOneIPv6RequestHistory checks that HTTP-01 challenges are served on an
+// IPv6 listener and that requests for an IPv6 literal end up in the same
+// request history whichever form the literal is written in.
+func TestHTTPOneIPv6RequestHistory(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		HTTPOneAddrs: []string{"[::1]:0"},
+	})
+	srv.AddHTTPOneChallenge("token", "key-authorization")
+
+	testCases := []struct {
+		name    string
+		host    string
+		lookups []string
+	}{
+		{
+			name:    "bracketed with port",
+			host:    srv.HTTPOneAddr(),
+			lookups: []string{"::1", "[::1]", "0:0:0:0:0:0:0:1"},
+		},
+		{
+			name:    "bracketed without port",
+			host:    "[::1]",
+			lookups: []string{"::1", "[0:0:0:0:0:0:0:1]"},
+		},
+		{
+			name:    "uncompressed",
+			host:    "[0:0:0:0:0:0:0:1]",
+			lookups: []string{"::1", "[::1]"},
+		},
+		{
+			name:    "IPv4 mapped",
+			host:    "[::ffff:127.0.0.1]",
+			lookups: []string{"127.0.0.1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.ClearRequestHistory(tc.lookups[0], challtestsrv.HTTPRequestEventType)
+
+			req, err := http.NewRequest("GET", "http://"+srv.HTTPOneAddr()+"/.well-known/acme-challenge/token", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = tc.host
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("getting HTTP-01 challenge over IPv6: %s", err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("reading HTTP-01 challenge: %s", err)
+			}
+			if string(body) != "key-authorization" {
+				t.Errorf("HTTP-01 challenge = %q, want %q", body, "key-authorization")
+			}
+
+			for _, lookup := range tc.lookups {
+				if n := len(srv.RequestHistory(lookup, challtestsrv.HTTPRequestEventType)); n != 1 {
+					t.Errorf("request history for %q has %d events, want 1", lookup, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package challtestsrv
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	challpb "github.com/letsencrypt/challtestsrv/proto"
+)
+
+// managementServer implements the ChallSrv gRPC service by calling the
+// corresponding methods of a ChallSrv.
+type managementServer struct {
+	challpb.UnimplementedChallSrvServer
+	challSrv *ChallSrv
+}
+
+func (m managementServer) AddHTTPOneChallenge(_ context.Context, req *challpb.HTTPOneChallenge) (*emptypb.Empty, error) {
+	m.challSrv.AddHTTPOneChallenge(req.Token, req.Content)
+	return &emptypb.Empty{}, nil
+}
+
+func (m managementServer) DeleteHTTPOneChallenge(_ context.Context, req *challpb.Token) (*emptypb.Empty, error) {
+	m.challSrv.DeleteHTTPOneChallenge(req.Token)
+	return &emptypb.Empty{}, nil
+}
+
+func (m managementServer) GetHTTPOneChallenge(_ context.Context, req *challpb.Token) (*challpb.HTTPOneChallenge, error) {
+	content, found := m.challSrv.GetHTTPOneChallenge(req.Token)
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "no HTTP-01 challenge for token %q", req.Token)
+	}
+	return &challpb.HTTPOneChallenge{Token: req.Token, Content: content}, nil
+}
+
+func (m managementServer) AddDNSOneChallenge(_ context.Context, req *challpb.DNSOneChallenge) (*emptypb.Empty, error) {
+	m.challSrv.AddDNSOneChallenge(req.Host, req.Content)
+	return &emptypb.Empty{}, nil
+}
+
+func (m managementServer) DeleteDNSOneChallenge(_ context.Context, req *challpb.Host) (*emptypb.Empty, error) {
+	m.challSrv.DeleteDNSOneChallenge(req.Host)
+	return &emptypb.Empty{}, nil
+}
+
+func (m managementServer) GetDNSOneChallenge(_ context.Context, req *challpb.Host) (*challpb.DNSOneChallenges, error) {
+	contents := m.challSrv.GetDNSOneChallenge(req.Host)
+	if len(contents) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no DNS-01 challenge for host %q", req.Host)
+	}
+	return &challpb.DNSOneChallenges{Host: req.Host, Contents: contents}, nil
+}
+
+func (m managementServer) AddTLSALPNChallenge(_ context.Context, req *challpb.TLSALPNChallenge) (*emptypb.Empty, error) {
+	m.challSrv.AddTLSALPNChallenge(req.Host, req.Content)
+	return &emptypb.Empty{}, nil
+}
+
+func (m managementServer) DeleteTLSALPNChallenge(_ context.Context, req *challpb.Host) (*emptypb.Empty, error) {
+	m.challSrv.DeleteTLSALPNChallenge(req.Host)
+	return &emptypb.Empty{}, nil
+}
+
+func (m managementServer) GetTLSALPNChallenge(_ context.Context, req *challpb.Host) (*challpb.TLSALPNChallenge, error) {
+	content, found := m.challSrv.GetTLSALPNChallenge(req.Host)
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "no TLS-ALPN-01 challenge for host %q", req.Host)
+	}
+	return &challpb.TLSALPNChallenge{Host: req.Host, Content: content}, nil
+}
+
+// challGRPCServer is a *grpc.Server bound to an address that implements the
+// challengeServer interface.
+type challGRPCServer struct {
+	*grpc.Server
+	address string
+	bound   *boundAddrs
+}
+
+func (c challGRPCServer) ListenAndServe() error {
+	l, err := net.Listen("tcp", c.address)
+	if err != nil {
+		return err
+	}
+	c.bound.add(l.Addr())
+	return c.Server.Serve(l)
+}
+
+func (c challGRPCServer) Addrs() []string {
+	return c.bound.list()
+}
+
+func (c challGRPCServer) Shutdown() error {
+	c.Server.GracefulStop()
+	return nil
+}
+
+// grpcServer creates a gRPC management server for the given ChallSrv. The
+// server is not authenticated and is only meant to be used for testing.
+func grpcServer(address string, challSrv *ChallSrv) challengeServer {
+	srv := grpc.NewServer()
+	challpb.RegisterChallSrvServer(srv, managementServer{challSrv: challSrv})
+	return challGRPCServer{
+		Server:  srv,
+		address: address,
+		bound:   &boundAddrs{},
+	}
+}
+
+// GRPCClient is a client for the gRPC management server of a ChallSrv. Its
+// methods mirror the ChallSrv methods of the same name.
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	client challpb.ChallSrvClient
+}
+
+// DialGRPC connects to the ChallSrv gRPC management server at the given
+// address. The connection is not encrypted.
+func DialGRPC(address string) (*GRPCClient, error) {
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{
+		conn:   conn,
+		client: challpb.NewChallSrvClient(conn),
+	}, nil
+}
+
+// Close closes the client's connection to the management server.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// AddHTTPOneChallenge adds a new HTTP-01 challenge for the given token and
+// content.
+func (c *GRPCClient) AddHTTPOneChallenge(ctx context.Context, token, content string) error {
+	_, err := c.client.AddHTTPOneChallenge(ctx, &challpb.HTTPOneChallenge{Token: token, Content: content})
+	return err
+}
+
+// DeleteHTTPOneChallenge deletes a given HTTP-01 challenge token.
+func (c *GRPCClient) DeleteHTTPOneChallenge(ctx context.Context, token string) error {
+	_, err := c.client.DeleteHTTPOneChallenge(ctx, &challpb.Token{Token: token})
+	return err
+}
+
+// GetHTTPOneChallenge returns the HTTP-01 challenge content for the given token
+// and a true bool. If the token does not exist then an empty string and a false
+// bool are returned.
+func (c *GRPCClient) GetHTTPOneChallenge(ctx context.Context, token string) (string, bool, error) {
+	resp, err := c.client.GetHTTPOneChallenge(ctx, &challpb.Token{Token: token})
+	if status.Code(err) == codes.NotFound {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return resp.Content, true, nil
+}
+
+// AddDNSOneChallenge adds a TXT record for the given host with the given
+// content.
+func (c *GRPCClient) AddDNSOneChallenge(ctx context.Context, host, content string) error {
+	_, err := c.client.AddDNSOneChallenge(ctx, &challpb.DNSOneChallenge{Host: host, Content: content})
+	return err
+}
+
+// DeleteDNSOneChallenge deletes a TXT record for the given host.
+func (c *GRPCClient) DeleteDNSOneChallenge(ctx context.Context, host string) error {
+	_, err := c.client.DeleteDNSOneChallenge(ctx, &challpb.Host{Host: host})
+	return err
+}
+
+// GetDNSOneChallenge returns a slice of TXT record values for the given host.
+// If the host does not exist in the challenge response data then nil is
+// returned.
+func (c *GRPCClient) GetDNSOneChallenge(ctx context.Context, host string) ([]string, error) {
+	resp, err := c.client.GetDNSOneChallenge(ctx, &challpb.Host{Host: host})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return resp.Contents, nil
+}
+
+// AddTLSALPNChallenge adds a new TLS-ALPN-01 key authorization for the given
+// host.
+func (c *GRPCClient) AddTLSALPNChallenge(ctx context.Context, host, content string) error {
+	_, err := c.client.AddTLSALPNChallenge(ctx, &challpb.TLSALPNChallenge{Host: host, Content: content})
+	return err
+}
+
+// DeleteTLSALPNChallenge deletes the key authorization for a given host.
+func (c *GRPCClient) DeleteTLSALPNChallenge(ctx context.Context, host string) error {
+	_, err := c.client.DeleteTLSALPNChallenge(ctx, &challpb.Host{Host: host})
+	return err
+}
+
+// GetTLSALPNChallenge returns the key authorization for the given host and
+// a true bool. If there is no challenge for the host then an empty string and
+// a false bool are returned.
+func (c *GRPCClient) GetTLSALPNChallenge(ctx context.Context, host string) (string, bool, error) {
+	resp, err := c.client.GetTLSALPNChallenge(ctx, &challpb.Host{Host: host})
+	if status.Code(err) == codes.NotFound {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return resp.Content, true, nil
+}
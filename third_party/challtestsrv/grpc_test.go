@@ -0,0 +1,78 @@
+package challtestsrv_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+func TestGRPCManagement(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		GRPCAddrs: []string{"127.0.0.1:0"},
+	})
+	client, err := challtestsrv.DialGRPC(srv.GRPCAddr())
+	if err != nil {
+		t.Fatalf("dialing gRPC management server: %s", err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP-01
+	if err := client.AddHTTPOneChallenge(ctx, "token", "http"); err != nil {
+		t.Fatalf("AddHTTPOneChallenge: %s", err)
+	}
+	if _, body := getHTTPOne(t, srv, "token"); body != "http" {
+		t.Errorf("HTTP-01 server served %q, want %q", body, "http")
+	}
+	if content, found, err := client.GetHTTPOneChallenge(ctx, "token"); err != nil || !found || content != "http" {
+		t.Errorf("GetHTTPOneChallenge = %q, %t, %v, want %q, true, nil", content, found, err, "http")
+	}
+	if err := client.DeleteHTTPOneChallenge(ctx, "token"); err != nil {
+		t.Fatalf("DeleteHTTPOneChallenge: %s", err)
+	}
+	if content, found, err := client.GetHTTPOneChallenge(ctx, "token"); err != nil || found {
+		t.Errorf("GetHTTPOneChallenge after delete = %q, %t, %v, want not found", content, found, err)
+	}
+
+	// DNS-01
+	const dnsHost = "_acme-challenge.example.com."
+	for _, content := range []string{"dns-a", "dns-b"} {
+		if err := client.AddDNSOneChallenge(ctx, dnsHost, content); err != nil {
+			t.Fatalf("AddDNSOneChallenge: %s", err)
+		}
+	}
+	if got := srv.GetDNSOneChallenge(dnsHost); !reflect.DeepEqual(got, []string{"dns-a", "dns-b"}) {
+		t.Errorf("ChallSrv has DNS-01 values %q, want [dns-a dns-b]", got)
+	}
+	if got, err := client.GetDNSOneChallenge(ctx, dnsHost); err != nil || !reflect.DeepEqual(got, []string{"dns-a", "dns-b"}) {
+		t.Errorf("GetDNSOneChallenge = %q, %v, want [dns-a dns-b], nil", got, err)
+	}
+	if err := client.DeleteDNSOneChallenge(ctx, dnsHost); err != nil {
+		t.Fatalf("DeleteDNSOneChallenge: %s", err)
+	}
+	if got, err := client.GetDNSOneChallenge(ctx, dnsHost); err != nil || got != nil {
+		t.Errorf("GetDNSOneChallenge after delete = %q, %v, want nil, nil", got, err)
+	}
+
+	// TLS-ALPN-01
+	if err := client.AddTLSALPNChallenge(ctx, "example.com", "tls"); err != nil {
+		t.Fatalf("AddTLSALPNChallenge: %s", err)
+	}
+	if _, err := handshakeTLSALPN(srv, "example.com"); err != nil {
+		t.Errorf("handshake for a challenge added over gRPC failed: %s", err)
+	}
+	if content, found, err := client.GetTLSALPNChallenge(ctx, "example.com"); err != nil || !found || content != "tls" {
+		t.Errorf("GetTLSALPNChallenge = %q, %t, %v, want %q, true, nil", content, found, err, "tls")
+	}
+	if err := client.DeleteTLSALPNChallenge(ctx, "example.com"); err != nil {
+		t.Fatalf("DeleteTLSALPNChallenge: %s", err)
+	}
+	if content, found, err := client.GetTLSALPNChallenge(ctx, "example.com"); err != nil || found {
+		t.Errorf("GetTLSALPNChallenge after delete = %q, %t, %v, want not found", content, found, err)
+	}
+}
@@ -0,0 +1,130 @@
+package challtestsrv_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/miekg/dns"
+)
+
+// getHTTPOne requests the HTTP-01 challenge response for token from the
+// ChallSrv's HTTP-01 server and returns the response and its body.
+func getHTTPOne(t *testing.T, srv *challtestsrv.ChallSrv, token string) (*http.Response, string) {
+	t.Helper()
+	client := &http.Client{
+		// Redirects are returned to the test rather than followed.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + srv.HTTPOneAddr() + "/.well-known/acme-challenge/" + token)
+	if err != nil {
+		t.Fatalf("getting HTTP-01 challenge %q: %s", token, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading HTTP-01 challenge %q: %s", token, err)
+	}
+	return resp, string(body)
+}
+
+// queryDNS sends a query for name and qtype to the ChallSrv's DNS-01 server
+// over the given network, "udp" or "tcp", and returns the response.
+func queryDNS(t *testing.T, srv *challtestsrv.ChallSrv, network, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	client := &dns.Client{Net: network, Timeout: 5 * time.Second}
+	r, _, err := client.Exchange(m, srv.DNSOneAddr())
+	if err != nil {
+		t.Fatalf("querying %s %s over %s: %s", dns.TypeToString[qtype], name, network, err)
+	}
+	return r
+}
+
+// txtValues returns the strings of the TXT records in answers, with the
+// character-strings of each record concatenated like a validator does.
+func txtValues(answers []dns.RR) []string {
+	var values []string
+	for _, rr := range answers {
+		if txt, ok := rr.(*dns.TXT); ok {
+			values = append(values, strings.Join(txt.Txt, ""))
+		}
+	}
+	return values
+}
+
+// handshakeTLSALPN performs an acme-tls/1 handshake with the ChallSrv for the
+// given SNI over an in-memory connection.
+func handshakeTLSALPN(srv *challtestsrv.ChallSrv, sni string) (tls.ConnectionState, error) {
+	return handshakeProtos(srv, sni, challtestsrv.ACMETLS1Protocol)
+}
+
+// handshakeProtos is like handshakeTLSALPN but offers the given ALPN
+// protocols, or none, instead of acme-tls/1.
+func handshakeProtos(srv *challtestsrv.ChallSrv, sni string, protos ...string) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.TLSALPNHandshake(ctx, &tls.Config{
+		ServerName:         sni,
+		NextProtos:         protos,
+		InsecureSkipVerify: true,
+	})
+}
+
+// acmeIdentifierExtensions returns the acmeIdentifier extensions of cert.
+func acmeIdentifierExtensions(cert *x509.Certificate) []pkix.Extension {
+	var exts []pkix.Extension
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(challtestsrv.IDPeAcmeIdentifier) {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// acmeIdentifierDigest returns the key authorization digest in the single
+// acmeIdentifier extension of cert.
+func acmeIdentifierDigest(t *testing.T, cert *x509.Certificate) []byte {
+	t.Helper()
+	exts := acmeIdentifierExtensions(cert)
+	if len(exts) != 1 {
+		t.Fatalf("got %d acmeIdentifier extensions, want 1", len(exts))
+	}
+	var digest []byte
+	if _, err := asn1.Unmarshal(exts[0].Value, &digest); err != nil {
+		t.Fatalf("parsing acmeIdentifier extension: %s", err)
+	}
+	return digest
+}
+
+// dialTLS performs a TLS handshake with the server at addr on the given
+// network, "tcp" or "unix", for the given SNI and ALPN protocols, and returns
+// the connection state.
+func dialTLS(network, addr, sni string, protos ...string) (tls.ConnectionState, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 5 * time.Second},
+		Config: &tls.Config{
+			ServerName:         sni,
+			NextProtos:         protos,
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.Dial(network, addr)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.(*tls.Conn).ConnectionState(), nil
+}
@@ -0,0 +1,385 @@
+package challtestsrv
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// wellKnownPath is the IANA registered ACME HTTP-01 challenge path. See
+// https://tools.ietf.org/html/draft-ietf-acme-acme-16#section-9.2
+const wellKnownPath = "/.well-known/acme-challenge/"
+
+// selfSignedCert issues a self-signed CA certificate to use as the leaf
+// certificate for an HTTPS server serving HTTP-01 challenges. The certificate's
+// ECDSA key is generated on the given curve. This certificate will not be
+// trusted by normal TLS clients but HTTP-01 redirects to HTTPS will ignore
+// certificate validation.
+func selfSignedCert(curve elliptic.Curve) tls.Certificate {
+	cert, err := NewSelfSignedCert(curve, nil)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to issue HTTPS cert: %v", err))
+	}
+	return cert
+}
+
+// NewSelfSignedCert issues a self-signed CA certificate like the fallback
+// certificate used by the HTTPS HTTP-01 and TLS-ALPN-01 servers, with an ECDSA
+// key generated on the given curve. If customize is not nil it is called with
+// the certificate template before the certificate is issued so that the default
+// subject, validity, key usages and basic constraints can be changed. This is
+// useful for simulating misconfigured TLS servers, e.g. by passing the result
+// to SetTLSALPNFallbackCert.
+func NewSelfSignedCert(curve elliptic.Curve, customize func(template *x509.Certificate)) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to generate ECDSA key: %s", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to generate cert serial number: %s", err)
+	}
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: "challenge test server",
+		},
+		SerialNumber:          serial,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if customize != nil {
+		customize(template)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to issue cert: %s", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// FallbackCertDER returns the DER encoding of the leaf of the fallback
+// certificate the ChallSrv was created with, i.e. the Config's FallbackCert or
+// the self-signed certificate issued in its place. It is used by the HTTPS
+// HTTP-01 and DNS-over-HTTPS servers and by the TLS-ALPN-01 server unless
+// replaced with SetTLSALPNFallbackCert, see GetTLSALPNFallbackCert. This is
+// useful for checking that validators never mistake the fallback certificate,
+// which has no acmeIdentifier extension, for a challenge response. It returns
+// nil if the fallback certificate is empty.
+func (s *ChallSrv) FallbackCertDER() []byte {
+	if len(s.fallbackCert.Certificate) == 0 {
+		return nil
+	}
+	return append([]byte(nil), s.fallbackCert.Certificate[0]...)
+}
+
+// AddHTTPOneChallenge adds a new HTTP-01 challenge for the given token and
+// content. The content, normally the key authorization, is served to requests
+// for "/.well-known/acme-challenge/<token>" by the HTTP-01 challenge servers.
+// Adding another challenge for the same token replaces it.
+func (s *ChallSrv) AddHTTPOneChallenge(token, content string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.httpOne[token] = content
+}
+
+// AddHTTPOneChallenges adds the HTTP-01 challenges in the given map of token to
+// content, like calling AddHTTPOneChallenge for each but taking the challenge
+// lock only once.
+func (s *ChallSrv) AddHTTPOneChallenges(challenges map[string]string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	for token, content := range challenges {
+		s.httpOne[token] = content
+	}
+}
+
+// DeleteHTTPOneChallenge deletes a given HTTP-01 challenge token.
+func (s *ChallSrv) DeleteHTTPOneChallenge(token string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	delete(s.httpOne, token)
+}
+
+// GetHTTPOneChallenge returns the HTTP-01 challenge content for the given token
+// (if it exists) and a true bool. If the token does not exist then an empty
+// string and a false bool are returned.
+func (s *ChallSrv) GetHTTPOneChallenge(token string) (string, bool) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	content, present := s.httpOne[token]
+	return content, present
+}
+
+// AddHTTPRedirect adds a redirect for the given path to the given URL.
+func (s *ChallSrv) AddHTTPRedirect(path, targetURL string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.redirects[path] = targetURL
+}
+
+// DeleteHTTPRedirect deletes a redirect for the given path.
+func (s *ChallSrv) DeleteHTTPRedirect(path string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	delete(s.redirects, path)
+}
+
+// GetHTTPRedirect returns the redirect target for the given path
+// (if it exists) and a true bool. If the path does not have a redirect target
+// then an empty string and a false bool are returned.
+func (s *ChallSrv) GetHTTPRedirect(path string) (string, bool) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	targetURL, present := s.redirects[path]
+	return targetURL, present
+}
+
+// ServeHTTP handles an HTTP request. If the request path has the ACME HTTP-01
+// challenge well known prefix as a prefix and the token specified is known,
+// then the challenge response contents are returned.
+func (s *ChallSrv) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+
+	serverName := ""
+	if r.TLS != nil {
+		serverName = r.TLS.ServerName
+	}
+
+	s.AddRequestEvent(HTTPRequestEvent{
+		URL:        r.URL.String(),
+		Host:       r.Host,
+		HTTPS:      r.TLS != nil,
+		ServerName: serverName,
+	})
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	s.metrics.httpOneRequests.WithLabelValues(scheme).Inc()
+
+	// If the request was not over HTTPS and we have a redirect, serve it.
+	// Redirects are ignored over HTTPS so we can easily do an HTTP->HTTPS
+	// redirect for a token path without creating a loop.
+	if redirectTarget, found := s.GetHTTPRedirect(requestPath); found && r.TLS == nil {
+		http.Redirect(w, r, redirectTarget, http.StatusFound)
+		return
+	}
+
+	if requestPath == TLSHelloDebugPath && serveTLSHelloDebug(w, r) {
+		return
+	}
+
+	if strings.HasPrefix(requestPath, wellKnownPath) {
+		token := requestPath[len(wellKnownPath):]
+		outcome := s.serveHTTPOneChallenge(w, r, token)
+		s.notifyChallenge(ChallengeEvent{
+			Type:       HTTPRequestEventType,
+			Identifier: token,
+			Outcome:    string(outcome),
+		}, outcome == httpOneServedChallenge)
+	}
+}
+
+// httpOneOutcome describes how the HTTP-01 challenge server answered
+// a request for a token.
+type httpOneOutcome string
+
+const (
+	// httpOneServedChallenge means the key authorization was served.
+	httpOneServedChallenge httpOneOutcome = "served-challenge"
+	// httpOneServedRedirect means a SetHTTPOneRedirect redirect was served.
+	httpOneServedRedirect httpOneOutcome = "served-redirect"
+	// httpOneServedStatus means a SetHTTPOneResponseStatus status was served.
+	httpOneServedStatus httpOneOutcome = "served-status"
+	// httpOneUnknownToken means no challenge was added for the token.
+	httpOneUnknownToken httpOneOutcome = "unknown-token"
+	// httpOneAborted means the client went away or the server shut down during a
+	// SetHTTPOneDelay delay.
+	httpOneAborted httpOneOutcome = "aborted"
+	// httpOneConnectionReset means the connection was reset because of
+	// SetHTTPOneConnectionReset.
+	httpOneConnectionReset httpOneOutcome = "connection-reset"
+	// httpOneChaosFailure means a 503 was written because of
+	// SetChaosFailureRate.
+	httpOneChaosFailure httpOneOutcome = "chaos-failure"
+)
+
+// serveHTTPOneChallenge writes the HTTP-01 challenge response for the given
+// token, applying any per-token settings from s.httpOneMocks, and describes
+// how the request was answered.
+func (s *ChallSrv) serveHTTPOneChallenge(w http.ResponseWriter, r *http.Request, token string) httpOneOutcome {
+	if s.chaosFailure() {
+		http.Error(w, "injected transient failure", http.StatusServiceUnavailable)
+		return httpOneChaosFailure
+	}
+
+	if delay := s.GetHTTPOneDelay(token); delay > 0 {
+		if !sleepContext(r.Context(), delay) {
+			return httpOneAborted
+		}
+	}
+
+	if s.GetHTTPOneConnectionReset(token) {
+		resetHTTPConnection(w)
+		return httpOneConnectionReset
+	}
+
+	if location, status, found := s.GetHTTPOneRedirect(token); found {
+		http.Redirect(w, r, location, status)
+		return httpOneServedRedirect
+	}
+
+	if status := s.GetHTTPOneResponseStatus(token); status != 0 {
+		location := s.GetHTTPOneResponseLocation(token)
+		if location != "" && status >= 300 && status < 400 {
+			w.Header().Set("Location", location)
+		}
+		w.WriteHeader(status)
+		return httpOneServedStatus
+	}
+
+	auth, found := s.GetHTTPOneChallenge(token)
+	if !found {
+		return httpOneUnknownToken
+	}
+	if contentType := s.GetHTTPOneContentType(token); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	fmt.Fprintf(w, "%s", auth)
+	writeHTTPOnePadding(r.Context(), w, s.GetHTTPOneResponsePadding(token))
+	return httpOneServedChallenge
+}
+
+// resetHTTPConnection hijacks the connection of the given response and closes
+// it with a zero linger time, so a TCP RST is sent instead of a graceful FIN.
+// If the connection can't be hijacked a 500 is written instead.
+func resetHTTPConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be hijacked", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	netConn := conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		netConn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := netConn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = netConn.Close()
+}
+
+// httpOnePaddingChunk is the filler written repeatedly by writeHTTPOnePadding.
+var httpOnePaddingChunk = []byte(strings.Repeat("x", 32*1024))
+
+// writeHTTPOnePadding writes n bytes of filler to w one chunk at a time,
+// stopping early if a write fails or ctx is done (e.g. because the client hung
+// up).
+func writeHTTPOnePadding(ctx context.Context, w http.ResponseWriter, n int) {
+	for n > 0 && ctx.Err() == nil {
+		chunk := httpOnePaddingChunk
+		if n < len(chunk) {
+			chunk = chunk[:n]
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+		n -= len(chunk)
+	}
+}
+
+// challHTTPServer is a *http.Server that has a Shutdown() func that doesn't
+// take a context argument. This lets us treat the HTTP server the same as the
+// DNS-01 servers (which use a `dns.Server` that has `Shutdown()` with no
+// context arg) by having an http.Server that implements the challengeServer
+// interface.
+type challHTTPServer struct {
+	*http.Server
+	bound *boundAddrs
+}
+
+// ListenAndServe for a challHTTPServer will call the underlying http.Server's
+// ListenAndServeTLS if the server has a non-nil TLSConfig, otherwise it will
+// use the underlying http.Server's ListenAndServe(). This allows for
+// a challHTTPServer to be both a normal HTTP based HTTP-01 challenge response
+// server in one configuration (nil TLSConfig) and an HTTPS based HTTP-01
+// challenge response server useful for redirect targets in another
+// configuration.
+func (c challHTTPServer) ListenAndServe() error {
+	l, err := net.Listen("tcp", c.Server.Addr)
+	if err != nil {
+		return err
+	}
+	c.bound.add(l.Addr())
+	if c.Server.TLSConfig != nil {
+		// This will use the certificate and key from TLSConfig.
+		return c.Server.ServeTLS(l, "", "")
+	}
+	// Otherwise use HTTP
+	return c.Server.Serve(l)
+}
+
+func (c challHTTPServer) Addrs() []string {
+	return c.bound.list()
+}
+
+func (c challHTTPServer) Shutdown() error {
+	return c.Server.Shutdown(context.Background())
+}
+
+// httpOneServer creates an ACME HTTP-01 challenge server. The
+// server's handler will return configured HTTP-01 challenge responses for
+// tokens that have been added to the challenge server. If HTTPS is true the
+// resulting challengeServer will run a HTTPS server with a self-signed
+// certificate useful for HTTP-01 -> HTTPS HTTP-01 redirect responses. If HTTPS
+// is false the resulting challengeServer will run an HTTP server.
+func httpOneServer(address string, handler http.Handler, https bool, fallbackCert tls.Certificate) challengeServer {
+	// If HTTPS is requested build a TLS Config that uses the provided
+	// self-signed certificate.
+	var tlsConfig *tls.Config
+	if https {
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{fallbackCert},
+		}
+	}
+	// Create an HTTP Server for HTTP-01 challenges
+	srv := &http.Server{
+		Addr:         address,
+		Handler:      handler,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		TLSConfig:    tlsConfig,
+	}
+	srv.SetKeepAlivesEnabled(false)
+	return challHTTPServer{srv, &boundAddrs{}}
+}
@@ -0,0 +1,435 @@
+package challtestsrv_test
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+func TestHTTPOneChallenge(t *testing.T) {
+	const token = "token"
+
+	testCases := []struct {
+		name     string
+		change   func(*challtestsrv.ChallSrv)
+		wantBody string
+		wantOK   bool
+	}{
+		{
+			name:   "not added",
+			change: func(*challtestsrv.ChallSrv) {},
+		},
+		{
+			name:     "added",
+			change:   func(srv *challtestsrv.ChallSrv) { srv.AddHTTPOneChallenge(token, "first") },
+			wantBody: "first",
+			wantOK:   true,
+		},
+		{
+			name:     "added again",
+			change:   func(srv *challtestsrv.ChallSrv) { srv.AddHTTPOneChallenge(token, "second") },
+			wantBody: "second",
+			wantOK:   true,
+		},
+		{
+			name:   "deleted",
+			change: func(srv *challtestsrv.ChallSrv) { srv.DeleteHTTPOneChallenge(token) },
+		},
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	// The cases run in order against the same server.
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.change(srv)
+
+			content, ok := srv.GetHTTPOneChallenge(token)
+			if content != tc.wantBody || ok != tc.wantOK {
+				t.Errorf("GetHTTPOneChallenge = %q, %t, want %q, %t", content, ok, tc.wantBody, tc.wantOK)
+			}
+			// Unknown tokens get an empty 200 response.
+			resp, body := getHTTPOne(t, srv, token)
+			if resp.StatusCode != http.StatusOK || body != tc.wantBody {
+				t.Errorf("got a %d response with body %q, want a 200 with %q", resp.StatusCode, body, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestHTTPOneConnectionReset(t *testing.T) {
+	testCases := []struct {
+		name      string
+		reset     bool
+		wantReset bool
+	}{
+		{name: "reset", reset: true, wantReset: true},
+		{name: "reset removed", reset: false, wantReset: false},
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", "key-authorization")
+	srv.SetHTTPOneConnectionReset("token", true)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.SetHTTPOneConnectionReset("token", tc.reset)
+
+			resp, err := http.Get("http://" + srv.HTTPOneAddr() + "/.well-known/acme-challenge/token")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if gotReset := errors.Is(err, syscall.ECONNRESET); gotReset != tc.wantReset {
+				t.Errorf("got error %v, want a connection reset: %t", err, tc.wantReset)
+			}
+		})
+	}
+}
+
+func TestNewSelfSignedCertExtKeyUsage(t *testing.T) {
+	testCases := []struct {
+		name      string
+		customize func(*x509.Certificate)
+		want      []x509.ExtKeyUsage
+	}{
+		{
+			name: "default",
+			want: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		},
+		{
+			name:      "client auth only",
+			customize: func(tmpl *x509.Certificate) { tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth} },
+			want:      []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+		{
+			name:      "none",
+			customize: func(tmpl *x509.Certificate) { tmpl.ExtKeyUsage = nil },
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cert, err := challtestsrv.NewSelfSignedCert(elliptic.P256(), tc.customize)
+			if err != nil {
+				t.Fatalf("NewSelfSignedCert: %s", err)
+			}
+
+			// The certificate is served as is by the TLS-ALPN-01 server.
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			srv.SetTLSALPNFallbackCert(cert)
+			state, err := handshakeProtos(srv, "example.com")
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			if got := state.PeerCertificates[0].ExtKeyUsage; !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ExtKeyUsage = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHTTPOneRedirectChain(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.SetHTTPOneRedirect("first", "/.well-known/acme-challenge/second", http.StatusMovedPermanently)
+	// A status that isn't a redirect becomes a 302.
+	srv.SetHTTPOneRedirect("second", "/.well-known/acme-challenge/final", http.StatusOK)
+	srv.AddHTTPOneChallenge("final", "key-authorization")
+	srv.SetHTTPOneRedirect("loop-a", "/.well-known/acme-challenge/loop-b", http.StatusFound)
+	srv.SetHTTPOneRedirect("loop-b", "/.well-known/acme-challenge/loop-a", http.StatusFound)
+
+	testCases := []struct {
+		token        string
+		wantStatus   int
+		wantLocation string
+	}{
+		{token: "first", wantStatus: http.StatusMovedPermanently, wantLocation: "/.well-known/acme-challenge/second"},
+		{token: "second", wantStatus: http.StatusFound, wantLocation: "/.well-known/acme-challenge/final"},
+		{token: "final", wantStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		resp, _ := getHTTPOne(t, srv, tc.token)
+		if resp.StatusCode != tc.wantStatus || resp.Header.Get("Location") != tc.wantLocation {
+			t.Errorf("%s: got %d to %q, want %d to %q", tc.token,
+				resp.StatusCode, resp.Header.Get("Location"), tc.wantStatus, tc.wantLocation)
+		}
+	}
+
+	// A client following the redirects ends up at the challenge.
+	resp, err := http.Get("http://" + srv.HTTPOneAddr() + "/.well-known/acme-challenge/first")
+	if err != nil {
+		t.Fatalf("following redirects: %s", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "key-authorization" {
+		t.Errorf("following redirects got %q, want the key authorization", body)
+	}
+
+	// A loop runs into the client's redirect limit.
+	if _, err := http.Get("http://" + srv.HTTPOneAddr() + "/.well-known/acme-challenge/loop-a"); err == nil ||
+		!strings.Contains(err.Error(), "stopped after 10 redirects") {
+		t.Errorf("following a redirect loop returned %v, want the redirect limit error", err)
+	}
+
+	srv.SetHTTPOneRedirect("first", "", 0)
+	if resp, _ := getHTTPOne(t, srv, "first"); resp.StatusCode != http.StatusOK || resp.Header.Get("Location") != "" {
+		t.Errorf("got %d to %q after removing the redirect, want no redirect", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestHTTPOneDelay(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenges(map[string]string{"slow": "slow", "fast": "fast"})
+	srv.SetHTTPOneDelay("slow", delay)
+
+	testCases := []struct {
+		token    string
+		wantSlow bool
+	}{
+		{token: "slow", wantSlow: true},
+		{token: "fast"},
+	}
+	for _, tc := range testCases {
+		start := time.Now()
+		_, body := getHTTPOne(t, srv, tc.token)
+		elapsed := time.Since(start)
+		if body != tc.token {
+			t.Errorf("%s: got %q, want %q", tc.token, body, tc.token)
+		}
+		if slow := elapsed >= delay; slow != tc.wantSlow {
+			t.Errorf("%s: response took %s, want delayed %t", tc.token, elapsed, tc.wantSlow)
+		}
+	}
+
+	srv.SetHTTPOneDelay("slow", 0)
+	if got := srv.GetHTTPOneDelay("slow"); got != 0 {
+		t.Errorf("GetHTTPOneDelay = %s after removing the delay", got)
+	}
+}
+
+func TestHTTPOneResponsePadding(t *testing.T) {
+	const keyAuth = "key-authorization"
+	const padding = 1<<20 + 7
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", keyAuth)
+	srv.SetHTTPOneResponsePadding("token", padding)
+
+	_, body := getHTTPOne(t, srv, "token")
+	if len(body) != len(keyAuth)+padding {
+		t.Errorf("got a %d byte body, want %d", len(body), len(keyAuth)+padding)
+	}
+	if !strings.HasPrefix(body, keyAuth) || strings.Trim(body[len(keyAuth):], "x") != "" {
+		t.Error("body isn't the key authorization followed by filler")
+	}
+
+	// A client that stops reading early doesn't stall the server.
+	resp, err := http.Get("http://" + srv.HTTPOneAddr() + "/.well-known/acme-challenge/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := io.ReadAll(io.LimitReader(resp.Body, 128))
+	resp.Body.Close()
+	if err != nil || len(limited) != 128 {
+		t.Errorf("reading the first 128 bytes got %d bytes and %v", len(limited), err)
+	}
+
+	srv.SetHTTPOneResponsePadding("token", 0)
+	if _, body := getHTTPOne(t, srv, "token"); body != keyAuth {
+		t.Errorf("got a %d byte body after removing the padding, want only the key authorization", len(body))
+	}
+}
+
+func TestFallbackCertPerServer(t *testing.T) {
+	first, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	second, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	if bytes.Equal(first.FallbackCertDER(), second.FallbackCertDER()) {
+		t.Error("two ChallSrvs share the same fallback certificate")
+	}
+
+	// An injected certificate is used instead of issuing one.
+	injected, err := challtestsrv.NewSelfSignedCert(elliptic.P256(), nil)
+	if err != nil {
+		t.Fatalf("issuing certificate: %s", err)
+	}
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{FallbackCert: &injected})
+	if !bytes.Equal(srv.FallbackCertDER(), injected.Certificate[0]) {
+		t.Error("FallbackCertDER isn't the Config's FallbackCert")
+	}
+	state, err := handshakeProtos(srv, "example.com")
+	if err != nil {
+		t.Fatalf("handshake without ALPN failed: %s", err)
+	}
+	if !bytes.Equal(state.PeerCertificates[0].Raw, injected.Certificate[0]) {
+		t.Error("handshake without ALPN wasn't served the Config's FallbackCert")
+	}
+}
+
+func TestFallbackCertDER(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{HTTPSOneAddrs: []string{"127.0.0.1:0"}})
+	srv.AddTLSALPNChallenge("example.com", "key-authorization")
+
+	der := srv.FallbackCertDER()
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing FallbackCertDER: %s", err)
+	}
+	if exts := acmeIdentifierExtensions(cert); len(exts) != 0 {
+		t.Errorf("fallback certificate has %d acmeIdentifier extensions, want none", len(exts))
+	}
+
+	// It is the certificate served by the HTTPS server and, even for a host
+	// with a challenge, by the TLS-ALPN-01 server without ALPN.
+	httpsState, err := dialTLS("tcp", srv.HTTPSOneAddr(), "example.com")
+	if err != nil {
+		t.Fatalf("handshake with the HTTPS server failed: %s", err)
+	}
+	if !bytes.Equal(httpsState.PeerCertificates[0].Raw, der) {
+		t.Error("HTTPS server didn't serve the FallbackCertDER certificate")
+	}
+	state, err := handshakeProtos(srv, "example.com")
+	if err != nil {
+		t.Fatalf("handshake without ALPN failed: %s", err)
+	}
+	if !bytes.Equal(state.PeerCertificates[0].Raw, der) {
+		t.Error("handshake without ALPN wasn't served the FallbackCertDER certificate")
+	}
+
+	// The returned bytes are a copy.
+	der[0] ^= 0xFF
+	if bytes.Equal(srv.FallbackCertDER(), der) {
+		t.Error("changing the FallbackCertDER bytes changed the fallback certificate")
+	}
+}
+
+func TestFallbackCertValidity(t *testing.T) {
+	// Certificate dates only have second precision.
+	now := time.Now().Truncate(time.Second)
+	injected, err := challtestsrv.NewSelfSignedCert(elliptic.P256(), nil)
+	if err != nil {
+		t.Fatalf("issuing certificate: %s", err)
+	}
+
+	testCases := []struct {
+		name          string
+		config        challtestsrv.Config
+		opts          []challtestsrv.Option
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+		wantErr       string
+	}{
+		{
+			name: "expired",
+			config: challtestsrv.Config{
+				FallbackCertNotBefore: now.Add(-48 * time.Hour),
+				FallbackCertNotAfter:  now.Add(-24 * time.Hour),
+			},
+			wantNotBefore: now.Add(-48 * time.Hour),
+			wantNotAfter:  now.Add(-24 * time.Hour),
+		},
+		{
+			name:          "not yet valid option",
+			opts:          []challtestsrv.Option{challtestsrv.WithFallbackCertValidity(now.Add(time.Hour), now.Add(48*time.Hour))},
+			wantNotBefore: now.Add(time.Hour),
+			wantNotAfter:  now.Add(48 * time.Hour),
+		},
+		{
+			name:    "NotAfter before NotBefore",
+			config:  challtestsrv.Config{FallbackCertNotBefore: now, FallbackCertNotAfter: now.Add(-time.Hour)},
+			wantErr: "is before its NotBefore",
+		},
+		{
+			// The default NotBefore is an hour ago.
+			name:    "NotAfter before the default NotBefore",
+			config:  challtestsrv.Config{FallbackCertNotAfter: now.Add(-2 * time.Hour)},
+			wantErr: "is before its NotBefore",
+		},
+		{
+			// The default NotAfter is a year from now.
+			name:    "NotBefore after the default NotAfter",
+			config:  challtestsrv.Config{FallbackCertNotBefore: now.AddDate(2, 0, 0)},
+			wantErr: "is before its NotBefore",
+		},
+		{
+			name:    "with FallbackCert",
+			config:  challtestsrv.Config{FallbackCert: &injected, FallbackCertNotAfter: now.Add(time.Hour)},
+			wantErr: "can't be used with FallbackCert",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			config.TLSALPNOneAddrs = []string{"127.0.0.1:0"}
+			config.Log = log.New(io.Discard, "", 0)
+			srv, err := challtestsrv.New(config, tc.opts...)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("New = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("creating challenge server: %s", err)
+			}
+			cert, err := x509.ParseCertificate(srv.FallbackCertDER())
+			if err != nil {
+				t.Fatalf("parsing fallback certificate: %s", err)
+			}
+			if !cert.NotBefore.Equal(tc.wantNotBefore) || !cert.NotAfter.Equal(tc.wantNotAfter) {
+				t.Errorf("fallback certificate is valid from %s to %s, want %s to %s",
+					cert.NotBefore, cert.NotAfter, tc.wantNotBefore, tc.wantNotAfter)
+			}
+
+			// The certificate with the window is the one served without ALPN.
+			state, err := handshakeProtos(srv, "example.com")
+			if err != nil {
+				t.Fatalf("handshake without ALPN failed: %s", err)
+			}
+			if !bytes.Equal(state.PeerCertificates[0].Raw, cert.Raw) {
+				t.Error("handshake without ALPN wasn't served the fallback certificate")
+			}
+		})
+	}
+}
+
+func TestHTTPOneContentType(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", "key-authorization")
+
+	testCases := []struct {
+		name        string
+		contentType string
+		want        string
+	}{
+		{name: "custom", contentType: "application/octet-stream", want: "application/octet-stream"},
+		{name: "default", want: "text/plain; charset=utf-8"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.SetHTTPOneContentType("token", tc.contentType)
+			if got := srv.GetHTTPOneContentType("token"); got != tc.contentType {
+				t.Errorf("GetHTTPOneContentType = %q, want %q", got, tc.contentType)
+			}
+			resp, body := getHTTPOne(t, srv, "token")
+			if got := resp.Header.Get("Content-Type"); got != tc.want {
+				t.Errorf("Content-Type = %q, want %q", got, tc.want)
+			}
+			if body != "key-authorization" {
+				t.Errorf("body = %q, want %q", body, "key-authorization")
+			}
+		})
+	}
+}
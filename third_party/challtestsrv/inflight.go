@@ -0,0 +1,90 @@
+package challtestsrv
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ShutdownReport describes the requests that were still in progress when
+// ShutdownWithReport began shutting down the challenge servers.
+type ShutdownReport struct {
+	// Interrupted maps a listener, as its network and bound address like
+	// "tcp 127.0.0.1:5002", to the number of requests it was handling.
+	// A request on an HTTP based listener is a connection that is completing
+	// its TLS handshake or has a request being answered; idle keep-alive
+	// connections aren't counted. Listeners without requests in progress are
+	// omitted. The gRPC management servers aren't tracked.
+	Interrupted map[string]int
+}
+
+// inFlightTracker counts the requests each listener of a ChallSrv is handling.
+type inFlightTracker struct {
+	mu     sync.Mutex
+	active map[string]int
+	// conns holds the func that ends the request of each tracked HTTP
+	// connection.
+	conns map[net.Conn]func()
+}
+
+func newInFlightTracker() *inFlightTracker {
+	return &inFlightTracker{
+		active: make(map[string]int),
+		conns:  make(map[net.Conn]func()),
+	}
+}
+
+// start records that the listener bound to addr started handling a request
+// and returns a func recording that the request has finished. The returned
+// func must be called exactly once.
+func (t *inFlightTracker) start(addr net.Addr) func() {
+	key := addr.Network() + " " + addr.String()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active[key]++
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.active[key]--
+		if t.active[key] == 0 {
+			delete(t.active, key)
+		}
+	}
+}
+
+// trackConn is an http.Server ConnState hook counting connections as in
+// progress from when they are accepted, or become active again after being
+// idle, until they are idle, hijacked or closed.
+func (t *inFlightTracker) trackConn(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew, http.StateActive:
+		t.mu.Lock()
+		_, tracked := t.conns[conn]
+		t.mu.Unlock()
+		if !tracked {
+			done := t.start(conn.LocalAddr())
+			t.mu.Lock()
+			t.conns[conn] = done
+			t.mu.Unlock()
+		}
+	case http.StateIdle, http.StateHijacked, http.StateClosed:
+		t.mu.Lock()
+		done, tracked := t.conns[conn]
+		delete(t.conns, conn)
+		t.mu.Unlock()
+		if tracked {
+			done()
+		}
+	}
+}
+
+// snapshot returns a copy of the number of requests in progress per listener.
+func (t *inFlightTracker) snapshot() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := make(map[string]int, len(t.active))
+	for key, count := range t.active {
+		active[key] = count
+	}
+	return active
+}
@@ -0,0 +1,54 @@
+package challtestsrv_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+func TestShutdownWithReport(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("slow", "slow")
+	srv.SetHTTPOneDelay("slow", 10*time.Second)
+	addr := srv.HTTPOneAddr()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.Get("http://" + addr + "/.well-known/acme-challenge/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	// Give the request time to reach the handler.
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	report := srv.ShutdownWithReport()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ShutdownWithReport took %s, want the delayed request cut off", elapsed)
+	}
+	want := map[string]int{"tcp " + addr: 1}
+	if !reflect.DeepEqual(report.Interrupted, want) {
+		t.Errorf("Interrupted = %v, want %v", report.Interrupted, want)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("delayed request didn't finish after ShutdownWithReport")
+	}
+}
+
+func TestShutdownWithReportIdle(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", "http")
+	getHTTPOne(t, srv, "token")
+
+	if report := srv.ShutdownWithReport(); len(report.Interrupted) != 0 {
+		t.Errorf("Interrupted = %v for an idle server, want none", report.Interrupted)
+	}
+}
@@ -0,0 +1,147 @@
+package challtestsrv
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// serverKind identifies what a challengeServer serves so that the addresses
+// its listeners are bound to can be looked up.
+type serverKind int
+
+const (
+	httpOneServerKind serverKind = iota
+	httpsOneServerKind
+	dnsOneServerKind
+	dohServerKind
+	tlsALPNServerKind
+	grpcServerKind
+)
+
+// boundAddrs records the addresses a challengeServer's listeners have been
+// bound to. Recording the resolved address rather than the configured one lets
+// servers be configured with port 0 and have the OS pick a free port.
+type boundAddrs struct {
+	mu    sync.RWMutex
+	addrs []string
+}
+
+// add records that a listener was bound to the given address.
+func (b *boundAddrs) add(addr net.Addr) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addrs = append(b.addrs, addr.String())
+}
+
+// list returns the addresses recorded with add, in the order they were bound.
+func (b *boundAddrs) list() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	addrs := make([]string, len(b.addrs))
+	copy(addrs, b.addrs)
+	return addrs
+}
+
+// addServer adds a challengeServer of the given kind to the ChallSrv. The
+// connections of HTTP based servers are tracked for ShutdownWithReport and
+// their request contexts are cancelled when it begins.
+func (s *ChallSrv) addServer(kind serverKind, srv challengeServer) {
+	baseContext := func(net.Listener) context.Context { return s.ctx }
+	switch srv := srv.(type) {
+	case challHTTPServer:
+		srv.ConnState = s.inFlight.trackConn
+		srv.BaseContext = baseContext
+	case challTLSServer:
+		srv.ConnState = s.inFlight.trackConn
+		srv.BaseContext = baseContext
+	}
+	s.servers = append(s.servers, srv)
+	s.serversByKind[kind] = append(s.serversByKind[kind], srv)
+}
+
+// boundAddr returns the first address a server of the given kind is bound to,
+// or an empty string if none have been bound yet.
+func (s *ChallSrv) boundAddr(kind serverKind) string {
+	for _, srv := range s.serversByKind[kind] {
+		if addrs := srv.Addrs(); len(addrs) > 0 {
+			return addrs[0]
+		}
+	}
+	return ""
+}
+
+// allBoundAddrs returns every address bound by the servers of the given kind.
+func (s *ChallSrv) allBoundAddrs(kind serverKind) []string {
+	var addrs []string
+	for _, srv := range s.serversByKind[kind] {
+		addrs = append(addrs, srv.Addrs()...)
+	}
+	return addrs
+}
+
+// Ready returns true once the listeners of every challenge server have been
+// bound, meaning the servers are accepting connections. It returns false
+// before Run is called and while servers are still starting.
+func (s *ChallSrv) Ready() bool {
+	for _, srv := range s.servers {
+		if len(srv.Addrs()) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitReady blocks until Ready returns true or the context is done, in which
+// case the context's error is returned. It lets callers wait for the servers
+// started by Run instead of sleeping.
+func (s *ChallSrv) WaitReady(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !s.Ready() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// HTTPOneAddr returns the address the first HTTP-01 challenge server is bound
+// to, including the port picked by the OS if it was configured with port 0.
+// Since servers are bound asynchronously after Run is called an empty string is
+// returned until the server is bound; use WaitReady to wait for it.
+func (s *ChallSrv) HTTPOneAddr() string {
+	return s.boundAddr(httpOneServerKind)
+}
+
+// HTTPSOneAddr is like HTTPOneAddr for the first HTTPS HTTP-01 challenge
+// server.
+func (s *ChallSrv) HTTPSOneAddr() string {
+	return s.boundAddr(httpsOneServerKind)
+}
+
+// DNSOneAddr is like HTTPOneAddr for the first DNS-01 challenge server. The UDP
+// and TCP listeners of a DNS-01 challenge server are always bound to the same
+// port.
+func (s *ChallSrv) DNSOneAddr() string {
+	return s.boundAddr(dnsOneServerKind)
+}
+
+// DOHAddr is like HTTPOneAddr for the first DNS-over-HTTPS server.
+func (s *ChallSrv) DOHAddr() string {
+	return s.boundAddr(dohServerKind)
+}
+
+// TLSALPNOneAddr is like HTTPOneAddr for the first of the TLS-ALPN-01
+// challenge server's addresses.
+func (s *ChallSrv) TLSALPNOneAddr() string {
+	return s.boundAddr(tlsALPNServerKind)
+}
+
+// GRPCAddr is like HTTPOneAddr for the first gRPC management server.
+func (s *ChallSrv) GRPCAddr() string {
+	return s.boundAddr(grpcServerKind)
+}
@@ -0,0 +1,58 @@
+package challtestsrv_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+)
+
+func TestReady(t *testing.T) {
+	srv, err := challtestsrv.New(challtestsrv.Config{
+		HTTPOneAddrs: []string{"127.0.0.1:0"},
+		DNSOneAddrs:  []string{"127.0.0.1:0"},
+		Log:          log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("creating challenge server: %s", err)
+	}
+
+	// Nothing is bound before Run.
+	if srv.Ready() {
+		t.Error("Ready() = true before Run")
+	}
+	if addr := srv.HTTPOneAddr(); addr != "" {
+		t.Errorf("HTTPOneAddr() = %q before Run, want \"\"", addr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.WaitReady(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitReady before Run = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	srv.Run()
+	defer srv.Shutdown()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady after Run: %s", err)
+	}
+	if !srv.Ready() {
+		t.Error("Ready() = false after WaitReady returned")
+	}
+	if !srv.Status().Ready {
+		t.Error("Status().Ready = false after WaitReady returned")
+	}
+	// The ephemeral ports have been picked by the OS.
+	for _, addr := range []string{srv.HTTPOneAddr(), srv.DNSOneAddr()} {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil || port == "0" {
+			t.Errorf("bound address %q doesn't have a port picked by the OS", addr)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package challtestsrv
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// challSrvMetrics holds the Prometheus collectors used to count challenge
+// server activity.
+type challSrvMetrics struct {
+	// registry holds all of the ChallSrv's collectors and is served by
+	// MetricsHandler.
+	registry *prometheus.Registry
+	// tlsALPNHandshakes counts TLS-ALPN-01 server handshakes by outcome.
+	tlsALPNHandshakes *prometheus.CounterVec
+	// httpOneRequests counts HTTP-01 server requests by scheme.
+	httpOneRequests *prometheus.CounterVec
+	// dnsQueries counts DNS server questions by query type.
+	dnsQueries *prometheus.CounterVec
+}
+
+// newChallSrvMetrics creates the challenge server's collectors and registers
+// them with a new registry as well as the given Registerer, if it is not nil.
+func newChallSrvMetrics(stats prometheus.Registerer) (challSrvMetrics, error) {
+	m := challSrvMetrics{
+		registry: prometheus.NewRegistry(),
+		tlsALPNHandshakes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "challtestsrv_tlsalpn_handshakes_total",
+			Help: "Number of TLS-ALPN-01 challenge server handshakes by outcome",
+		}, []string{"outcome"}),
+		httpOneRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "challtestsrv_httpone_requests_total",
+			Help: "Number of HTTP-01 challenge server requests by scheme",
+		}, []string{"scheme"}),
+		dnsQueries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "challtestsrv_dns_queries_total",
+			Help: "Number of DNS challenge server questions by query type",
+		}, []string{"qtype"}),
+	}
+
+	collectors := []prometheus.Collector{m.tlsALPNHandshakes, m.httpOneRequests, m.dnsQueries}
+	for _, c := range collectors {
+		m.registry.MustRegister(c)
+		if stats != nil {
+			if err := stats.Register(c); err != nil {
+				return challSrvMetrics{}, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// MetricsHandler returns an http.Handler that serves the challenge server's
+// Prometheus metrics.
+func (s *ChallSrv) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+}
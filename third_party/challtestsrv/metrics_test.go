@@ -0,0 +1,72 @@
+package challtestsrv_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	stats := prometheus.NewRegistry()
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{Stats: stats})
+	srv.AddHTTPOneChallenge("token", "http")
+	srv.AddTLSALPNChallenge("example.com", "tls")
+
+	getHTTPOne(t, srv, "token")
+	getHTTPOne(t, srv, "token")
+	queryDNS(t, srv, "udp", "example.com", dns.TypeA)
+	queryDNS(t, srv, "udp", "example.com", dns.TypeCAA)
+	if _, err := handshakeTLSALPN(srv, "example.com"); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	_, _ = handshakeTLSALPN(srv, "unknown.example.com")
+
+	rec := httptest.NewRecorder()
+	srv.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("MetricsHandler returned status %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`challtestsrv_httpone_requests_total{scheme="http"} 2`,
+		`challtestsrv_dns_queries_total{qtype="A"} 1`,
+		`challtestsrv_dns_queries_total{qtype="CAA"} 1`,
+		`challtestsrv_tlsalpn_handshakes_total{outcome="served-challenge"} 1`,
+		`challtestsrv_tlsalpn_handshakes_total{outcome="unknown-sni"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics don't include %q:\n%s", want, body)
+		}
+	}
+
+	// The same collectors are registered with the Config's Stats.
+	families, err := stats.Gather()
+	if err != nil {
+		t.Fatalf("gathering Stats: %s", err)
+	}
+	registered := make(map[string]bool)
+	for _, family := range families {
+		registered[family.GetName()] = true
+	}
+	for _, name := range []string{
+		"challtestsrv_httpone_requests_total",
+		"challtestsrv_dns_queries_total",
+		"challtestsrv_tlsalpn_handshakes_total",
+	} {
+		if !registered[name] {
+			t.Errorf("%s isn't registered with the Config's Stats", name)
+		}
+	}
+
+	// Registering the collectors twice fails.
+	_, err = challtestsrv.New(challtestsrv.Config{HTTPOneAddrs: []string{"127.0.0.1:0"}, Stats: stats})
+	if err == nil {
+		t.Error("New succeeded with a Stats registry that already has the collectors")
+	}
+}
@@ -0,0 +1,440 @@
+package challtestsrv
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnsMockHost returns the key used to store DNS mock data for the given host or
+// zone. DNS names are case insensitive so the name is lowercased and made fully
+// qualified, so that mocks match queries however their names are capitalized.
+func dnsMockHost(host string) string {
+	return strings.ToLower(dns.Fqdn(host))
+}
+
+// SetDefaultDNSIPv4 sets the default IPv4 address used for A query responses
+// that don't match hosts added with AddDNSARecord. Use "" to disable default
+// A query responses.
+func (s *ChallSrv) SetDefaultDNSIPv4(addr string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.dnsMocks.defaultIPv4 = addr
+}
+
+// SetDefaultDNSIPv6 sets the default IPv6 address used for AAAA query responses
+// that don't match hosts added with AddDNSAAAARecord. Use "" to disable default
+// AAAA query responses.
+func (s *ChallSrv) SetDefaultDNSIPv6(addr string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.dnsMocks.defaultIPv6 = addr
+}
+
+// GetDefaultDNSIPv4 gets the default IPv4 address used for A query responses
+// (in string form), or an empty string if no default is being used.
+func (s *ChallSrv) GetDefaultDNSIPv4() string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.dnsMocks.defaultIPv4
+}
+
+// GetDefaultDNSIPv6 gets the default IPv6 address used for AAAA query responses
+// (in string form), or an empty string if no default is being used.
+func (s *ChallSrv) GetDefaultDNSIPv6() string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.dnsMocks.defaultIPv6
+}
+
+// AddDNSCNAMERecord sets a CNAME record that will be used like an alias when
+// querying for other DNS records for the given host.
+func (s *ChallSrv) AddDNSCNAMERecord(host string, value string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	value = dns.Fqdn(value)
+	s.dnsMocks.cnameRecords[host] = value
+}
+
+// GetDNSCNAMERecord returns a target host if a CNAME is set for the querying
+// host and an empty string otherwise.
+func (s *ChallSrv) GetDNSCNAMERecord(host string) string {
+	s.challMu.RLock()
+	host = dnsMockHost(host)
+	defer s.challMu.RUnlock()
+	return s.dnsMocks.cnameRecords[host]
+}
+
+// DeleteDNSCAMERecord deletes any CNAME alias set for the given host.
+func (s *ChallSrv) DeleteDNSCNAMERecord(host string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	delete(s.dnsMocks.cnameRecords, host)
+}
+
+// AddDNSARecord adds IPv4 addresses that will be returned when querying for
+// A records for the given host. Addresses are appended to any already added
+// for the host and all of them are returned in a single answer.
+func (s *ChallSrv) AddDNSARecord(host string, addresses []string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	s.dnsMocks.aRecords[host] = append(s.dnsMocks.aRecords[host], addresses...)
+}
+
+// DeleteDNSARecord deletes any IPv4 addresses that will be returned when
+// querying for A records for the given host.
+func (s *ChallSrv) DeleteDNSARecord(host string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	delete(s.dnsMocks.aRecords, host)
+}
+
+// GetDNSARecord returns a slice of IPv4 addresses (in string form) that will be
+// returned when querying for A records for the given host.
+func (s *ChallSrv) GetDNSARecord(host string) []string {
+	s.challMu.RLock()
+	host = dnsMockHost(host)
+	defer s.challMu.RUnlock()
+	return s.dnsMocks.aRecords[host]
+}
+
+// AddDNSAAAARecord adds IPv6 addresses that will be returned when querying for
+// AAAA records for the given host. Addresses are appended to any already added
+// for the host and all of them are returned in a single answer.
+func (s *ChallSrv) AddDNSAAAARecord(host string, addresses []string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	s.dnsMocks.aaaaRecords[host] = append(s.dnsMocks.aaaaRecords[host], addresses...)
+}
+
+// DeleteDNSAAAARecord deletes any IPv6 addresses that will be returned when
+// querying for AAAA records for the given host.
+func (s *ChallSrv) DeleteDNSAAAARecord(host string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	delete(s.dnsMocks.aaaaRecords, host)
+}
+
+// GetDNSAAAARecord returns a slice of IPv6 addresses (in string form) that will
+// be returned when querying for AAAA records for the given host.
+func (s *ChallSrv) GetDNSAAAARecord(host string) []string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.aaaaRecords[host]
+}
+
+// AddDNSCAARecord adds mock CAA records that will be returned when querying
+// CAA for the given host. Policies are appended to any already added for the
+// host, so combined policies (e.g. both issue and issuewild) can be built up
+// over several calls.
+func (s *ChallSrv) AddDNSCAARecord(host string, policies []MockCAAPolicy) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	s.dnsMocks.caaRecords[host] = append(s.dnsMocks.caaRecords[host], policies...)
+}
+
+// DeleteDNSCAARecord deletes any CAA policies that will be returned when
+// querying CAA for the given host.
+func (s *ChallSrv) DeleteDNSCAARecord(host string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	delete(s.dnsMocks.caaRecords, host)
+}
+
+// GetDNSCAARecord returns a slice of mock CAA policies that will
+// be returned when querying CAA for the given host.
+func (s *ChallSrv) GetDNSCAARecord(host string) []MockCAAPolicy {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.caaRecords[host]
+}
+
+// AddDNSServFailRecord configures the chall srv to return SERVFAIL responses
+// for all queries for the given host.
+func (s *ChallSrv) AddDNSServFailRecord(host string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	s.dnsMocks.servFailRecords[host] = true
+}
+
+// DeleteDNSServFailRecord configures the chall srv to no longer return SERVFAIL
+// responses for all queries for the given host.
+func (s *ChallSrv) DeleteDNSServFailRecord(host string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	delete(s.dnsMocks.servFailRecords, host)
+}
+
+// GetDNSServFailRecord returns true when the chall srv has been configured with
+// AddDNSServFailRecord to return SERVFAIL for all queries to the given host.
+func (s *ChallSrv) GetDNSServFailRecord(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.servFailRecords[host]
+}
+
+// SetDNSUnknownTypeRcode sets the rcode used to respond to queries of a type
+// the chall srv doesn't support. It defaults to dns.RcodeNotImplemented. ANY
+// and HINFO queries are always answered, see dnsHandler.
+func (s *ChallSrv) SetDNSUnknownTypeRcode(rcode int) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.dnsMocks.unknownTypeRcode = rcode
+}
+
+// GetDNSUnknownTypeRcode returns the rcode set with SetDNSUnknownTypeRcode.
+func (s *ChallSrv) GetDNSUnknownTypeRcode() int {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.dnsMocks.unknownTypeRcode
+}
+
+// SetDNSSOA sets the SOA record included in the authority section of responses
+// for names in the given zone, including negative (NXDOMAIN and NODATA)
+// responses. The record's header is filled in with the zone as its name, so
+// only the Ttl of soa.Hdr is used. When zones are nested the most specific one
+// is used. Names outside of any zone set this way get a fixed mock SOA record.
+func (s *ChallSrv) SetDNSSOA(zone string, soa dns.SOA) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	zone = dnsMockHost(zone)
+	soa.Hdr = dns.RR_Header{
+		Name:   zone,
+		Rrtype: dns.TypeSOA,
+		Class:  dns.ClassINET,
+		Ttl:    soa.Hdr.Ttl,
+	}
+	s.dnsMocks.soaRecords[zone] = soa
+}
+
+// DeleteDNSSOA deletes the SOA record set with SetDNSSOA for the given zone.
+func (s *ChallSrv) DeleteDNSSOA(zone string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	zone = dnsMockHost(zone)
+	delete(s.dnsMocks.soaRecords, zone)
+}
+
+// GetDNSSOA returns the SOA record for the most specific zone set with
+// SetDNSSOA that contains the given name and true, or a nil record and false if
+// the name isn't in any such zone.
+func (s *ChallSrv) GetDNSSOA(name string) (*dns.SOA, bool) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	name = dnsMockHost(name)
+	var best *dns.SOA
+	bestLabels := -1
+	for zone, soa := range s.dnsMocks.soaRecords {
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		if labels := dns.CountLabel(zone); labels > bestLabels {
+			soa := soa
+			best, bestLabels = &soa, labels
+		}
+	}
+	return best, best != nil
+}
+
+// SetDNSRecordTTL sets the TTL of all answer records returned for queries for
+// the given host. Use a zero TTL to go back to the default of 0.
+func (s *ChallSrv) SetDNSRecordTTL(host string, ttl uint32) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	if ttl == 0 {
+		delete(s.dnsMocks.ttls, host)
+		return
+	}
+	s.dnsMocks.ttls[host] = ttl
+}
+
+// GetDNSRecordTTL returns the TTL set with SetDNSRecordTTL for the given host,
+// or 0 if there is none.
+func (s *ChallSrv) GetDNSRecordTTL(host string) uint32 {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.ttls[host]
+}
+
+// SetDNSError configures the chall srv to respond to all queries for the given
+// host with the given rcode (e.g. dns.RcodeNameError for NXDOMAIN) and no
+// answers. Use dns.RcodeSuccess to go back to answering normally.
+func (s *ChallSrv) SetDNSError(host string, rcode int) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	if rcode == dns.RcodeSuccess {
+		delete(s.dnsMocks.errors, host)
+		return
+	}
+	s.dnsMocks.errors[host] = rcode
+}
+
+// GetDNSError returns the rcode set with SetDNSError for the given host, or
+// dns.RcodeSuccess if there is none.
+func (s *ChallSrv) GetDNSError(host string) int {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.errors[host]
+}
+
+// SetDNSTruncate configures the chall srv to respond to UDP queries for the
+// given host with an empty answer and the TC bit set, forcing clients to retry
+// over TCP. Queries made over TCP are answered normally.
+func (s *ChallSrv) SetDNSTruncate(host string, truncate bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	if !truncate {
+		delete(s.dnsMocks.truncateRecords, host)
+		return
+	}
+	s.dnsMocks.truncateRecords[host] = true
+}
+
+// SetDNSAnswerName configures the chall srv to use ownerName as the owner name
+// of the answer records for the given host instead of the name in the query,
+// e.g. the same name with different case or an unrelated name. Since names are
+// always fully qualified on the wire ownerName is made fully qualified too. For
+// a host aliased with a CNAME record this applies to the host the CNAME points
+// at. This is useful for testing whether validators match the owner name of
+// answers to their query. Use an empty ownerName to use the queried name again.
+func (s *ChallSrv) SetDNSAnswerName(host, ownerName string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	if ownerName == "" {
+		delete(s.dnsMocks.answerNames, host)
+		return
+	}
+	s.dnsMocks.answerNames[host] = dns.Fqdn(ownerName)
+}
+
+// GetDNSAnswerName returns the owner name set with SetDNSAnswerName for the
+// given host, or an empty string if none is set.
+func (s *ChallSrv) GetDNSAnswerName(host string) string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.answerNames[host]
+}
+
+// SetDNSTCPOnly configures the chall srv to refuse UDP queries for the given
+// host with a REFUSED rcode and no answers, without setting the TC bit, so the
+// records for the host can only be looked up over TCP or DNS-over-HTTPS. This
+// is useful for testing validators that fall back to TCP on their own.
+func (s *ChallSrv) SetDNSTCPOnly(host string, tcpOnly bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	if !tcpOnly {
+		delete(s.dnsMocks.tcpOnlyRecords, host)
+		return
+	}
+	s.dnsMocks.tcpOnlyRecords[host] = true
+}
+
+// GetDNSTCPOnly returns true when the chall srv has been configured with
+// SetDNSTCPOnly to refuse UDP queries for the given host.
+func (s *ChallSrv) GetDNSTCPOnly(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.tcpOnlyRecords[host]
+}
+
+// GetDNSTruncate returns true when the chall srv has been configured with
+// SetDNSTruncate to truncate UDP responses for the given host.
+func (s *ChallSrv) GetDNSTruncate(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.truncateRecords[host]
+}
+
+// SetDNSDelay configures the chall srv to wait for the given duration before
+// answering queries for the given host, over both UDP and TCP. This is useful
+// for testing resolver timeouts. A DNS-over-HTTPS query is abandoned without
+// a reply if its client goes away during the delay, but plain UDP and TCP
+// queries have no way to notice that and are only abandoned when the server is
+// shut down. Use a zero duration to remove the delay.
+func (s *ChallSrv) SetDNSDelay(host string, d time.Duration) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = dnsMockHost(host)
+	if d <= 0 {
+		delete(s.dnsMocks.delays, host)
+		return
+	}
+	s.dnsMocks.delays[host] = d
+}
+
+// dnsJitter holds the range and the source of the random delays set with
+// SetDNSJitter.
+type dnsJitter struct {
+	min, max time.Duration
+	rand     *rand.Rand
+}
+
+// SetDNSJitter configures the chall srv to wait for a random duration between
+// minDelay and maxDelay, inclusive, before answering every query, in addition
+// to any delay set with SetDNSDelay. The durations are drawn from a source
+// seeded with seed, so the same seed gives the same sequence of delays for the
+// same sequence of queries. This is useful for testing resolver retries and
+// timeouts under variable latency. Use a zero maxDelay to remove the jitter.
+func (s *ChallSrv) SetDNSJitter(minDelay, maxDelay time.Duration, seed int64) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if maxDelay <= 0 {
+		s.dnsMocks.jitter = nil
+		return
+	}
+	if minDelay > maxDelay {
+		minDelay = maxDelay
+	}
+	s.dnsMocks.jitter = &dnsJitter{
+		min:  minDelay,
+		max:  maxDelay,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// nextDNSJitter returns the next random delay set with SetDNSJitter, or zero
+// if there is no jitter.
+func (s *ChallSrv) nextDNSJitter() time.Duration {
+	// The source is advanced so the write lock is needed.
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	j := s.dnsMocks.jitter
+	if j == nil {
+		return 0
+	}
+	return j.min + time.Duration(j.rand.Int63n(int64(j.max-j.min)+1))
+}
+
+// GetDNSDelay returns the delay set with SetDNSDelay for the given host, or
+// zero if there is none.
+func (s *ChallSrv) GetDNSDelay(host string) time.Duration {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = dnsMockHost(host)
+	return s.dnsMocks.delays[host]
+}
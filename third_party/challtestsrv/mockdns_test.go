@@ -0,0 +1,296 @@
+package challtestsrv_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestDNSRecordTTL(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSARecord("ttl.example.com", []string{"192.0.2.1"})
+	srv.AddDNSOneChallenge("_acme-challenge.ttl.example.com.", "txt")
+	srv.SetDNSRecordTTL("ttl.example.com", 300)
+	srv.SetDNSRecordTTL("_acme-challenge.ttl.example.com", 60)
+
+	testCases := []struct {
+		name    string
+		qtype   uint16
+		wantTTL uint32
+	}{
+		{name: "ttl.example.com", qtype: dns.TypeA, wantTTL: 300},
+		{name: "_acme-challenge.ttl.example.com", qtype: dns.TypeTXT, wantTTL: 60},
+		// Names without a TTL set keep the default of 0.
+		{name: "other.example.com", qtype: dns.TypeA},
+	}
+	for _, tc := range testCases {
+		r := queryDNS(t, srv, "udp", tc.name, tc.qtype)
+		if len(r.Answer) == 0 {
+			t.Fatalf("%s %s: no answers", tc.name, dns.TypeToString[tc.qtype])
+		}
+		for _, rr := range r.Answer {
+			if rr.Header().Ttl != tc.wantTTL {
+				t.Errorf("%s %s: TTL = %d, want %d", tc.name, dns.TypeToString[tc.qtype], rr.Header().Ttl, tc.wantTTL)
+			}
+		}
+	}
+
+	srv.SetDNSRecordTTL("ttl.example.com", 0)
+	r := queryDNS(t, srv, "udp", "ttl.example.com", dns.TypeA)
+	if len(r.Answer) != 1 || r.Answer[0].Header().Ttl != 0 {
+		t.Errorf("got answers %v after removing the TTL, want one with TTL 0", r.Answer)
+	}
+}
+
+func TestDNSErrors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mock      func(srv *challtestsrv.ChallSrv, host string)
+		wantRcode int
+	}{
+		{
+			name:      "SERVFAIL",
+			mock:      func(srv *challtestsrv.ChallSrv, host string) { srv.AddDNSServFailRecord(host) },
+			wantRcode: dns.RcodeServerFailure,
+		},
+		{
+			name:      "NXDOMAIN",
+			mock:      func(srv *challtestsrv.ChallSrv, host string) { srv.SetDNSError(host, dns.RcodeNameError) },
+			wantRcode: dns.RcodeNameError,
+		},
+		{
+			name:      "REFUSED",
+			mock:      func(srv *challtestsrv.ChallSrv, host string) { srv.SetDNSError(host, dns.RcodeRefused) },
+			wantRcode: dns.RcodeRefused,
+		},
+		{
+			name: "removed",
+			mock: func(srv *challtestsrv.ChallSrv, host string) {
+				srv.AddDNSServFailRecord(host)
+				srv.DeleteDNSServFailRecord(host)
+				srv.SetDNSError(host, dns.RcodeNameError)
+				srv.SetDNSError(host, dns.RcodeSuccess)
+			},
+			wantRcode: dns.RcodeSuccess,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			const host = "_acme-challenge.broken.example.com."
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			srv.AddDNSOneChallenge(host, "txt")
+			tc.mock(srv, host)
+
+			for _, qtype := range []uint16{dns.TypeTXT, dns.TypeA} {
+				r := queryDNS(t, srv, "udp", host, qtype)
+				if r.Rcode != tc.wantRcode {
+					t.Errorf("%s rcode = %s, want %s", dns.TypeToString[qtype],
+						dns.RcodeToString[r.Rcode], dns.RcodeToString[tc.wantRcode])
+				}
+				if tc.wantRcode != dns.RcodeSuccess && len(r.Answer) != 0 {
+					t.Errorf("%s error response has answers %v", dns.TypeToString[qtype], r.Answer)
+				}
+			}
+			// Other names are unaffected.
+			if r := queryDNS(t, srv, "udp", "other.example.com", dns.TypeA); r.Rcode != dns.RcodeSuccess {
+				t.Errorf("rcode for another name = %s", dns.RcodeToString[r.Rcode])
+			}
+		})
+	}
+}
+
+func TestDNSTruncate(t *testing.T) {
+	const host = "_acme-challenge.truncated.example.com."
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSOneChallenge(host, "txt")
+	srv.SetDNSTruncate(host, true)
+
+	r := queryDNS(t, srv, "udp", host, dns.TypeTXT)
+	if !r.Truncated || len(r.Answer) != 0 {
+		t.Errorf("UDP response has TC %t and answers %v, want TC set and no answers", r.Truncated, r.Answer)
+	}
+	r = queryDNS(t, srv, "tcp", host, dns.TypeTXT)
+	if r.Truncated || len(txtValues(r.Answer)) != 1 {
+		t.Errorf("TCP response has TC %t and answers %v, want the TXT record", r.Truncated, r.Answer)
+	}
+
+	srv.SetDNSTruncate(host, false)
+	r = queryDNS(t, srv, "udp", host, dns.TypeTXT)
+	if r.Truncated || len(txtValues(r.Answer)) != 1 {
+		t.Errorf("UDP response after removing truncation has TC %t and answers %v", r.Truncated, r.Answer)
+	}
+}
+
+func TestDNSCAARecord(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	want := []challtestsrv.MockCAAPolicy{
+		{Flag: 128, Tag: "issue", Value: "ca.example.net"},
+		{Tag: "issuewild", Value: ";"},
+	}
+	srv.AddDNSCAARecord("caa.example.com", want[:1])
+	srv.AddDNSCAARecord("caa.example.com", want[1:])
+
+	r := queryDNS(t, srv, "udp", "caa.example.com", dns.TypeCAA)
+	if len(r.Answer) != len(want) {
+		t.Fatalf("got %d CAA records, want %d: %v", len(r.Answer), len(want), r.Answer)
+	}
+	for i, rr := range r.Answer {
+		caa, ok := rr.(*dns.CAA)
+		if !ok {
+			t.Fatalf("answer %d is %T, want *dns.CAA", i, rr)
+		}
+		got := challtestsrv.MockCAAPolicy{Flag: caa.Flag, Tag: caa.Tag, Value: caa.Value}
+		if got != want[i] {
+			t.Errorf("CAA record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	srv.DeleteDNSCAARecord("caa.example.com")
+	if r := queryDNS(t, srv, "udp", "caa.example.com", dns.TypeCAA); len(r.Answer) != 0 {
+		t.Errorf("got CAA records %v after DeleteDNSCAARecord, want none", r.Answer)
+	}
+}
+
+func TestDNSMultipleAddresses(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSARecord("multi.example.com", []string{"192.0.2.1"})
+	srv.AddDNSARecord("multi.example.com", []string{"192.0.2.2", "192.0.2.3"})
+	srv.AddDNSAAAARecord("multi.example.com", []string{"2001:db8::1", "2001:db8::2"})
+
+	var gotA []string
+	for _, rr := range queryDNS(t, srv, "udp", "multi.example.com", dns.TypeA).Answer {
+		gotA = append(gotA, rr.(*dns.A).A.String())
+	}
+	if want := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}; !reflect.DeepEqual(gotA, want) {
+		t.Errorf("A records = %q, want %q", gotA, want)
+	}
+	var gotAAAA []string
+	for _, rr := range queryDNS(t, srv, "udp", "multi.example.com", dns.TypeAAAA).Answer {
+		gotAAAA = append(gotAAAA, rr.(*dns.AAAA).AAAA.String())
+	}
+	if want := []string{"2001:db8::1", "2001:db8::2"}; !reflect.DeepEqual(gotAAAA, want) {
+		t.Errorf("AAAA records = %q, want %q", gotAAAA, want)
+	}
+}
+
+func TestDNSDelay(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSARecord("slow.example.com", []string{"192.0.2.1"})
+	srv.AddDNSARecord("fast.example.com", []string{"192.0.2.2"})
+	srv.SetDNSDelay("slow.example.com", delay)
+	if got := srv.GetDNSDelay("slow.example.com."); got != delay {
+		t.Errorf("GetDNSDelay = %s, want %s", got, delay)
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		start := time.Now()
+		queryDNS(t, srv, network, "slow.example.com", dns.TypeA)
+		if elapsed := time.Since(start); elapsed < delay {
+			t.Errorf("delayed query over %s answered after %s, want at least %s", network, elapsed, delay)
+		}
+	}
+	start := time.Now()
+	queryDNS(t, srv, "udp", "fast.example.com", dns.TypeA)
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("query for a host without a delay answered after %s", elapsed)
+	}
+
+	srv.SetDNSDelay("slow.example.com", 0)
+	if got := srv.GetDNSDelay("slow.example.com"); got != 0 {
+		t.Errorf("GetDNSDelay after removing the delay = %s, want 0", got)
+	}
+}
+
+func TestDNSMockNamesCaseInsensitive(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSARecord("Mixed.Example.COM", []string{"192.0.2.1"})
+	srv.AddDNSCAARecord("mixed.example.com.", []challtestsrv.MockCAAPolicy{{Tag: "issue", Value: "ca.example.net"}})
+	srv.SetDNSRecordTTL("MIXED.example.com", 60)
+	srv.SetDNSSOA("Example.com", dns.SOA{Ns: "ns.example.com.", Mbox: "hostmaster.example.com."})
+
+	for _, name := range []string{"mixed.example.com", "MIXED.EXAMPLE.COM", "mIxEd.example.com."} {
+		r := queryDNS(t, srv, "udp", name, dns.TypeA)
+		if len(r.Answer) != 1 || r.Answer[0].Header().Ttl != 60 {
+			t.Errorf("A query for %q: answers %v, want one record with TTL 60", name, r.Answer)
+		}
+		r = queryDNS(t, srv, "udp", name, dns.TypeCAA)
+		if len(r.Answer) != 1 {
+			t.Errorf("CAA query for %q: answers %v, want one record", name, r.Answer)
+		}
+		if soa, found := srv.GetDNSSOA(name); !found || soa.Ns != "ns.example.com." {
+			t.Errorf("GetDNSSOA(%q) = %v, %t, want the example.com SOA", name, soa, found)
+		}
+	}
+	if got := srv.GetDNSARecord("MiXeD.eXaMpLe.CoM"); len(got) != 1 {
+		t.Errorf("GetDNSARecord with a mixed-case name = %q, want [192.0.2.1]", got)
+	}
+
+	srv.DeleteDNSARecord("MIXED.EXAMPLE.COM.")
+	if got := srv.GetDNSARecord("mixed.example.com"); got != nil {
+		t.Errorf("GetDNSARecord after deleting with a different case = %q, want nil", got)
+	}
+}
+
+func TestDNSAnswerName(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSOneChallenge("_acme-challenge.owner.example.com.", "dns")
+	srv.SetDNSAnswerName("_acme-challenge.owner.example.com", "unrelated.example.net")
+	if got := srv.GetDNSAnswerName("_acme-challenge.owner.example.com."); got != "unrelated.example.net." {
+		t.Errorf("GetDNSAnswerName = %q, want %q", got, "unrelated.example.net.")
+	}
+
+	r := queryDNS(t, srv, "udp", "_acme-challenge.owner.example.com", dns.TypeTXT)
+	if len(r.Answer) != 1 {
+		t.Fatalf("got %d answers, want 1: %v", len(r.Answer), r.Answer)
+	}
+	if name := r.Answer[0].Header().Name; name != "unrelated.example.net." {
+		t.Errorf("answer owner name = %q, want %q", name, "unrelated.example.net.")
+	}
+	// The question section still carries the queried name.
+	if name := r.Question[0].Name; name != "_acme-challenge.owner.example.com." {
+		t.Errorf("question name = %q, want the queried name", name)
+	}
+
+	srv.SetDNSAnswerName("_acme-challenge.owner.example.com", "")
+	r = queryDNS(t, srv, "udp", "_acme-challenge.owner.example.com", dns.TypeTXT)
+	if len(r.Answer) != 1 || r.Answer[0].Header().Name != "_acme-challenge.owner.example.com." {
+		t.Errorf("answers after removing the owner name = %v, want one for the queried name", r.Answer)
+	}
+}
+
+func TestDNSJitter(t *testing.T) {
+	const (
+		minDelay = 100 * time.Millisecond
+		maxDelay = 150 * time.Millisecond
+	)
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddDNSARecord("jitter.example.com", []string{"192.0.2.1"})
+	srv.SetDNSDelay("delayed.example.com", minDelay)
+
+	srv.SetDNSJitter(minDelay, maxDelay, 1)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		queryDNS(t, srv, "udp", "jitter.example.com", dns.TypeA)
+		if elapsed := time.Since(start); elapsed < minDelay {
+			t.Errorf("query %d answered after %s, want at least %s of jitter", i, elapsed, minDelay)
+		}
+	}
+	// Jitter is added to any delay set for the host.
+	start := time.Now()
+	queryDNS(t, srv, "udp", "delayed.example.com", dns.TypeA)
+	if elapsed := time.Since(start); elapsed < 2*minDelay {
+		t.Errorf("delayed query answered after %s, want at least %s", elapsed, 2*minDelay)
+	}
+
+	srv.SetDNSJitter(0, 0, 0)
+	start = time.Now()
+	queryDNS(t, srv, "udp", "jitter.example.com", dns.TypeA)
+	if elapsed := time.Since(start); elapsed >= minDelay {
+		t.Errorf("query answered after %s once the jitter was removed", elapsed)
+	}
+}
@@ -0,0 +1,205 @@
+package challtestsrv
+
+import (
+	"net/http"
+	"time"
+)
+
+// mockHTTPOneData holds per-token settings used to alter the HTTP-01 challenge
+// responses served by ServeHTTP.
+type mockHTTPOneData struct {
+	// A map of token to the HTTP status code written instead of 200.
+	statuses map[string]int
+	// A map of token to the Location header written with a 3xx status from
+	// statuses.
+	locations map[string]string
+	// A map of token to a redirect served instead of the key authorization.
+	redirects map[string]httpOneRedirect
+	// A map of token to how long to wait before writing a response.
+	delays map[string]time.Duration
+	// A map of token to the number of filler bytes written after the key
+	// authorization.
+	padding map[string]int
+	// A map of tokens whose requests should have their connection reset
+	// instead of being answered.
+	resets map[string]bool
+	// A map of token to the Content-Type header of key authorization
+	// responses.
+	contentTypes map[string]string
+}
+
+// httpOneRedirect holds the target URL and 3xx status code of a redirect.
+type httpOneRedirect struct {
+	location string
+	status   int
+}
+
+// SetHTTPOneResponseStatus configures the HTTP-01 challenge server to respond
+// to requests for the given token with the given HTTP status code instead of
+// a 200 with the key authorization. For 3xx status codes the Location header
+// set with SetHTTPOneResponseLocation is included, if any. Use a zero status to
+// go back to serving the key authorization.
+func (s *ChallSrv) SetHTTPOneResponseStatus(token string, status int) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if status == 0 {
+		delete(s.httpOneMocks.statuses, token)
+		return
+	}
+	s.httpOneMocks.statuses[token] = status
+}
+
+// GetHTTPOneResponseStatus returns the HTTP status code set with
+// SetHTTPOneResponseStatus for the given token, or zero if there is none.
+func (s *ChallSrv) GetHTTPOneResponseStatus(token string) int {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.httpOneMocks.statuses[token]
+}
+
+// SetHTTPOneResponseLocation sets the Location header written with a 3xx
+// status set by SetHTTPOneResponseStatus for the given token. Without one the
+// 3xx response has no Location header. Use an empty location to remove it.
+func (s *ChallSrv) SetHTTPOneResponseLocation(token, location string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if location == "" {
+		delete(s.httpOneMocks.locations, token)
+		return
+	}
+	s.httpOneMocks.locations[token] = location
+}
+
+// GetHTTPOneResponseLocation returns the Location header set with
+// SetHTTPOneResponseLocation for the given token, or an empty string if none is
+// set.
+func (s *ChallSrv) GetHTTPOneResponseLocation(token string) string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.httpOneMocks.locations[token]
+}
+
+// SetHTTPOneRedirect configures the HTTP-01 challenge server to respond to
+// requests for the given token with a redirect to location using the given 3xx
+// status code. If status is not a 3xx status code 302 is used. Unlike
+// AddHTTPRedirect the redirect is served over both HTTP and HTTPS, so redirect
+// chains and loops between tokens can be built to test validators' redirect
+// limits. Use an empty location to remove the redirect.
+func (s *ChallSrv) SetHTTPOneRedirect(token string, location string, status int) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if location == "" {
+		delete(s.httpOneMocks.redirects, token)
+		return
+	}
+	if status < 300 || status > 399 {
+		status = http.StatusFound
+	}
+	s.httpOneMocks.redirects[token] = httpOneRedirect{
+		location: location,
+		status:   status,
+	}
+}
+
+// GetHTTPOneRedirect returns the location and status code set with
+// SetHTTPOneRedirect for the given token and true. If there is no redirect for
+// the token an empty string, zero and false are returned.
+func (s *ChallSrv) GetHTTPOneRedirect(token string) (string, int, bool) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	redirect, present := s.httpOneMocks.redirects[token]
+	return redirect.location, redirect.status, present
+}
+
+// SetHTTPOneDelay configures the HTTP-01 challenge server to wait for the given
+// duration before responding to requests for the given token. The wait is
+// abandoned without writing a response if the client disconnects first. This
+// is useful for testing validator fetch timeouts. Use a zero duration to remove
+// the delay.
+func (s *ChallSrv) SetHTTPOneDelay(token string, d time.Duration) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if d <= 0 {
+		delete(s.httpOneMocks.delays, token)
+		return
+	}
+	s.httpOneMocks.delays[token] = d
+}
+
+// GetHTTPOneDelay returns the response delay set with SetHTTPOneDelay for the
+// given token, or zero if there is none.
+func (s *ChallSrv) GetHTTPOneDelay(token string) time.Duration {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.httpOneMocks.delays[token]
+}
+
+// SetHTTPOneResponsePadding configures the HTTP-01 challenge server to follow
+// the key authorization for the given token with sizeBytes bytes of filler.
+// The filler is streamed in fixed size chunks rather than buffered, so very
+// large responses can be used to test validator body size limits. Use a zero
+// size to remove the padding.
+func (s *ChallSrv) SetHTTPOneResponsePadding(token string, sizeBytes int) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if sizeBytes <= 0 {
+		delete(s.httpOneMocks.padding, token)
+		return
+	}
+	s.httpOneMocks.padding[token] = sizeBytes
+}
+
+// GetHTTPOneResponsePadding returns the number of filler bytes set with
+// SetHTTPOneResponsePadding for the given token, or zero if there is none.
+func (s *ChallSrv) GetHTTPOneResponsePadding(token string) int {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.httpOneMocks.padding[token]
+}
+
+// SetHTTPOneConnectionReset configures the HTTP-01 challenge server to respond
+// to requests for the given token by abruptly resetting the connection after
+// reading the request, without writing a response. This is useful for testing
+// validator handling of connection errors.
+func (s *ChallSrv) SetHTTPOneConnectionReset(token string, reset bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if !reset {
+		delete(s.httpOneMocks.resets, token)
+		return
+	}
+	s.httpOneMocks.resets[token] = true
+}
+
+// SetHTTPOneContentType sets the Content-Type header of HTTP-01 challenge
+// responses for the given token. By default the header isn't set explicitly
+// and net/http sniffs it from the key authorization, which gives
+// "text/plain; charset=utf-8". This is useful for testing validator handling of
+// unexpected content types like "application/octet-stream". Use an empty
+// contentType to go back to the default.
+func (s *ChallSrv) SetHTTPOneContentType(token, contentType string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if contentType == "" {
+		delete(s.httpOneMocks.contentTypes, token)
+		return
+	}
+	s.httpOneMocks.contentTypes[token] = contentType
+}
+
+// GetHTTPOneContentType returns the Content-Type set with
+// SetHTTPOneContentType for the given token, or an empty string if none is set.
+func (s *ChallSrv) GetHTTPOneContentType(token string) string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.httpOneMocks.contentTypes[token]
+}
+
+// GetHTTPOneConnectionReset returns true when the HTTP-01 challenge server has
+// been configured with SetHTTPOneConnectionReset to reset connections for the
+// given token.
+func (s *ChallSrv) GetHTTPOneConnectionReset(token string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.httpOneMocks.resets[token]
+}
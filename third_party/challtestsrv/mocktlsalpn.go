@@ -0,0 +1,681 @@
+package challtestsrv
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"time"
+)
+
+// mockTLSALPNData holds per-host settings used to alter the TLS-ALPN-01
+// challenge certificates returned by ServeChallengeCertFunc.
+type mockTLSALPNData struct {
+	// A map of host to the serial number used for challenge certificates. Hosts
+	// without an entry get a randomly generated serial for each certificate.
+	serials map[string]*big.Int
+	// A map of hosts whose challenge certificates should be built without the
+	// acmeIdentifier extension.
+	omitExtension map[string]bool
+	// A map of host to the Critical flag used for the acmeIdentifier extension.
+	// Hosts without an entry use a critical extension.
+	extensionCritical map[string]bool
+	// A map of hosts added with AddTLSALPNChallengeWithBadHash whose
+	// acmeIdentifier extension should carry an incorrect digest.
+	badHash map[string]bool
+	// A map of host to additional DNS names included as SANs in challenge
+	// certificates.
+	extraSANs map[string][]string
+	// A map of host to how long to stall the TLS handshake before returning
+	// a certificate.
+	delays map[string]time.Duration
+	// A map of host to the validity window used for challenge certificates.
+	validity map[string]validityWindow
+	// A map of host to an error returned instead of a challenge certificate.
+	failures map[string]error
+	// A map of hosts whose challenge certificates should carry two copies of
+	// the acmeIdentifier extension.
+	duplicateExtension map[string]bool
+	// A map of host to a certificate served verbatim instead of a generated
+	// challenge certificate.
+	overrideCerts map[string]*tls.Certificate
+	// A map of host to the bytes presented as the DER encoded leaf
+	// certificate instead of a generated challenge certificate.
+	malformedDER map[string][]byte
+	// A map of host to an issuer that signs challenge certificates instead of
+	// the challenge certificates being self-signed.
+	issuers map[string]tlsALPNIssuer
+	// A map of host to an additional DER encoded certificate appended to the
+	// certificate chain served with challenge certificates.
+	intermediates map[string][]byte
+	// A map of host to the SAN used in challenge certificates instead of the
+	// host itself.
+	wrongSANs map[string]string
+	// A map of host to the handshake counter used to fail the first
+	// handshakes for the host.
+	flaky map[string]*flakyCounter
+	// A map of host to the OID used for the acmeIdentifier extension instead of
+	// IDPeAcmeIdentifier.
+	extensionOIDs map[string]asn1.ObjectIdentifier
+	// A map of hosts whose acmeIdentifier extension should carry the bare
+	// digest instead of a DER encoded OCTET STRING of it.
+	rawHash map[string]bool
+	// A map of hosts whose challenge certificates should be signed by a key
+	// other than the one whose public key they carry.
+	badSignature map[string]bool
+	// A map of hosts whose challenge certificates should be marked as CA
+	// certificates.
+	isCA map[string]bool
+	// A map of host to the TLS alert sent instead of completing handshakes
+	// for the host.
+	alerts map[string]TLSALPNAlert
+	// A map of SNI value to the certificate served for TLS handshakes with it
+	// that don't negotiate the acme-tls/1 protocol, taking precedence over
+	// fallbackCert.
+	defaultCerts map[string]*tls.Certificate
+	// The certificate served for TLS handshakes that don't negotiate the
+	// acme-tls/1 protocol. If nil the ChallSrv's self-signed fallback
+	// certificate is used.
+	fallbackCert *tls.Certificate
+}
+
+// tlsALPNIssuer holds a CA certificate and its key.
+type tlsALPNIssuer struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// flakyCounter counts the acme-tls/1 handshakes for a host set with
+// SetTLSALPNFlakyUntil.
+type flakyCounter struct {
+	successfulAfter int
+	handshakes      int
+}
+
+// validityWindow holds the NotBefore and NotAfter dates for a certificate.
+type validityWindow struct {
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// SetTLSALPNSerial sets the serial number used for TLS-ALPN-01 challenge
+// certificates issued for the given host. Use a nil serial to go back to
+// a randomly generated serial for each certificate.
+func (s *ChallSrv) SetTLSALPNSerial(host string, serial *big.Int) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if serial == nil {
+		delete(s.tlsALPNMocks.serials, host)
+		return
+	}
+	s.tlsALPNMocks.serials[host] = serial
+}
+
+// GetTLSALPNSerial returns the serial number set with SetTLSALPNSerial for the
+// given host, or nil if no serial has been set.
+func (s *ChallSrv) GetTLSALPNSerial(host string) *big.Int {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.serials[host]
+}
+
+// SetTLSALPNOmitExtension configures whether TLS-ALPN-01 challenge certificates
+// issued for the given host omit the acmeIdentifier extension. This is useful
+// for testing that validators reject challenge certificates missing the
+// extension.
+func (s *ChallSrv) SetTLSALPNOmitExtension(host string, omit bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if !omit {
+		delete(s.tlsALPNMocks.omitExtension, host)
+		return
+	}
+	s.tlsALPNMocks.omitExtension[host] = true
+}
+
+// GetTLSALPNOmitExtension returns true when the chall srv has been configured
+// with SetTLSALPNOmitExtension to omit the acmeIdentifier extension from
+// challenge certificates issued for the given host.
+func (s *ChallSrv) GetTLSALPNOmitExtension(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.omitExtension[host]
+}
+
+// SetTLSALPNExtensionCritical sets whether the acmeIdentifier extension in
+// TLS-ALPN-01 challenge certificates issued for the given host is marked
+// critical. RFC 8737 requires the extension to be critical so this is only
+// useful for testing that validators reject non-critical extensions.
+func (s *ChallSrv) SetTLSALPNExtensionCritical(host string, critical bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if critical {
+		delete(s.tlsALPNMocks.extensionCritical, host)
+		return
+	}
+	s.tlsALPNMocks.extensionCritical[host] = false
+}
+
+// GetTLSALPNExtensionCritical returns whether the acmeIdentifier extension in
+// challenge certificates issued for the given host is marked critical. This is
+// true unless changed with SetTLSALPNExtensionCritical.
+func (s *ChallSrv) GetTLSALPNExtensionCritical(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	if critical, present := s.tlsALPNMocks.extensionCritical[host]; present {
+		return critical
+	}
+	return true
+}
+
+// SetTLSALPNExtraSANs sets additional DNS names that will be included as SANs
+// alongside the requested ServerName in TLS-ALPN-01 challenge certificates
+// issued for the given host. RFC 8737 requires exactly one SAN so this is only
+// useful for testing that validators reject multi-SAN challenge certificates.
+// Use an empty slice to stop adding extra SANs.
+func (s *ChallSrv) SetTLSALPNExtraSANs(host string, names []string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if len(names) == 0 {
+		delete(s.tlsALPNMocks.extraSANs, host)
+		return
+	}
+	s.tlsALPNMocks.extraSANs[host] = append([]string(nil), names...)
+}
+
+// GetTLSALPNExtraSANs returns the additional DNS names set with
+// SetTLSALPNExtraSANs for the given host.
+func (s *ChallSrv) GetTLSALPNExtraSANs(host string) []string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.extraSANs[host]
+}
+
+// SetTLSALPNWrongSAN sets a name (or IP address) used as the SAN of TLS-ALPN-01
+// challenge certificates issued for the given host instead of the host itself.
+// The acmeIdentifier extension still carries the correct digest. RFC 8737
+// requires the SAN to match the identifier being validated so this is only
+// useful for testing that validators reject a mismatched SAN. Use an empty san
+// to go back to using the host.
+func (s *ChallSrv) SetTLSALPNWrongSAN(host string, san string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if san == "" {
+		delete(s.tlsALPNMocks.wrongSANs, host)
+		return
+	}
+	s.tlsALPNMocks.wrongSANs[host] = san
+}
+
+// GetTLSALPNWrongSAN returns the SAN set with SetTLSALPNWrongSAN for the given
+// host, or an empty string if there is none.
+func (s *ChallSrv) GetTLSALPNWrongSAN(host string) string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.wrongSANs[host]
+}
+
+// SetTLSALPNFlakyUntil makes the TLS-ALPN-01 challenge server fail the first
+// successfulAfter-1 acme-tls/1 handshakes for the given host, so that the
+// handshake numbered successfulAfter is the first to get a challenge
+// certificate. Calling it again restarts the count. This is useful for testing
+// validator retries against an intermittently available server. Use
+// a successfulAfter of 1 or less to stop failing handshakes.
+func (s *ChallSrv) SetTLSALPNFlakyUntil(host string, successfulAfter int) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if successfulAfter <= 1 {
+		delete(s.tlsALPNMocks.flaky, host)
+		return
+	}
+	s.tlsALPNMocks.flaky[host] = &flakyCounter{successfulAfter: successfulAfter}
+}
+
+// tlsALPNFlakyFailure counts an acme-tls/1 handshake for the given host and
+// returns true if it should fail because of SetTLSALPNFlakyUntil.
+func (s *ChallSrv) tlsALPNFlakyFailure(host string) bool {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	counter, present := s.tlsALPNMocks.flaky[host]
+	if !present {
+		return false
+	}
+	counter.handshakes++
+	return counter.handshakes < counter.successfulAfter
+}
+
+// SetTLSALPNExtensionOID sets the OID used for the acmeIdentifier extension of
+// TLS-ALPN-01 challenge certificates issued for the given host instead of
+// IDPeAcmeIdentifier. The extension value is unchanged. This is useful for
+// testing that validators reject challenge certificates that lack an extension
+// with the correct OID. Use a nil oid to go back to IDPeAcmeIdentifier.
+func (s *ChallSrv) SetTLSALPNExtensionOID(host string, oid asn1.ObjectIdentifier) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if oid == nil {
+		delete(s.tlsALPNMocks.extensionOIDs, host)
+		return
+	}
+	s.tlsALPNMocks.extensionOIDs[host] = append(asn1.ObjectIdentifier(nil), oid...)
+}
+
+// GetTLSALPNExtensionOID returns the OID used for the acmeIdentifier extension
+// of challenge certificates issued for the given host. This is
+// IDPeAcmeIdentifier unless changed with SetTLSALPNExtensionOID.
+func (s *ChallSrv) GetTLSALPNExtensionOID(host string) asn1.ObjectIdentifier {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	if oid, present := s.tlsALPNMocks.extensionOIDs[host]; present {
+		return oid
+	}
+	return IDPeAcmeIdentifier
+}
+
+// SetTLSALPNRawHash controls whether the acmeIdentifier extension of
+// TLS-ALPN-01 challenge certificates issued for the given host carries the bare
+// 32 byte SHA-256 digest instead of the DER encoding of an OCTET STRING holding
+// it. RFC 8737 requires the OCTET STRING so this is only useful for testing
+// that validators parse the extension value strictly.
+func (s *ChallSrv) SetTLSALPNRawHash(host string, raw bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if !raw {
+		delete(s.tlsALPNMocks.rawHash, host)
+		return
+	}
+	s.tlsALPNMocks.rawHash[host] = true
+}
+
+// GetTLSALPNRawHash returns true if SetTLSALPNRawHash was used to make the
+// acmeIdentifier extension for the given host carry the bare digest.
+func (s *ChallSrv) GetTLSALPNRawHash(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.rawHash[host]
+}
+
+// SetTLSALPNBadSignature controls whether TLS-ALPN-01 challenge certificates
+// issued for the given host are signed by a freshly generated key instead of
+// the key whose public key they carry, so their self-signature doesn't verify.
+// The handshake itself still succeeds since the server proves possession of the
+// certificate's key. RFC 8737 doesn't require validators to check the
+// signature so this is useful for pinning how validators treat it.
+func (s *ChallSrv) SetTLSALPNBadSignature(host string, bad bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if !bad {
+		delete(s.tlsALPNMocks.badSignature, host)
+		return
+	}
+	s.tlsALPNMocks.badSignature[host] = true
+}
+
+// GetTLSALPNBadSignature returns true if SetTLSALPNBadSignature was used to
+// make challenge certificates for the given host carry an invalid signature.
+func (s *ChallSrv) GetTLSALPNBadSignature(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.badSignature[host]
+}
+
+// SetTLSALPNIsCA controls whether TLS-ALPN-01 challenge certificates issued for
+// the given host have a valid basic constraints extension marking them as CA
+// certificates. By default challenge certificates have no basic constraints.
+// Challenge certificates shouldn't be CAs so this is useful for pinning how
+// validators treat the CA flag.
+func (s *ChallSrv) SetTLSALPNIsCA(host string, isCA bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if !isCA {
+		delete(s.tlsALPNMocks.isCA, host)
+		return
+	}
+	s.tlsALPNMocks.isCA[host] = true
+}
+
+// GetTLSALPNIsCA returns true if SetTLSALPNIsCA was used to mark challenge
+// certificates for the given host as CA certificates.
+func (s *ChallSrv) GetTLSALPNIsCA(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.isCA[host]
+}
+
+// TLSALPNAlert is a TLS alert the TLS-ALPN-01 challenge server can be
+// configured with SetTLSALPNAlert to send instead of completing a handshake.
+type TLSALPNAlert int
+
+const (
+	// TLSALPNAlertNone completes handshakes normally.
+	TLSALPNAlertNone TLSALPNAlert = iota
+	// TLSALPNAlertUnrecognizedName aborts handshakes with an unrecognized_name
+	// alert, like a server with no certificate for the ServerName.
+	TLSALPNAlertUnrecognizedName
+	// TLSALPNAlertNoApplicationProtocol aborts handshakes with
+	// a no_application_protocol alert, like a server that doesn't support any of
+	// the offered ALPN protocols. Handshakes that don't offer any ALPN protocols
+	// are completed normally since TLS servers never send this alert for them.
+	TLSALPNAlertNoApplicationProtocol
+)
+
+// SetTLSALPNAlert configures the TLS-ALPN-01 challenge server to abort all
+// handshakes for the given host with the given TLS alert, whether or not they
+// negotiate acme-tls/1. This is useful for testing how validators report
+// different TLS-level failures. Use TLSALPNAlertNone to complete handshakes
+// normally again.
+func (s *ChallSrv) SetTLSALPNAlert(host string, alert TLSALPNAlert) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if alert == TLSALPNAlertNone {
+		delete(s.tlsALPNMocks.alerts, host)
+		return
+	}
+	s.tlsALPNMocks.alerts[host] = alert
+}
+
+// GetTLSALPNAlert returns the TLS alert set with SetTLSALPNAlert for the given
+// host, or TLSALPNAlertNone if none has been set.
+func (s *ChallSrv) GetTLSALPNAlert(host string) TLSALPNAlert {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.alerts[host]
+}
+
+// SetTLSALPNDelay sets how long the TLS-ALPN-01 challenge server stalls
+// acme-tls/1 handshakes for the given host before returning a challenge
+// certificate. The delay is aborted if the client disconnects first. Use a zero
+// duration to remove the delay.
+func (s *ChallSrv) SetTLSALPNDelay(host string, d time.Duration) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if d <= 0 {
+		delete(s.tlsALPNMocks.delays, host)
+		return
+	}
+	s.tlsALPNMocks.delays[host] = d
+}
+
+// GetTLSALPNDelay returns the handshake delay set with SetTLSALPNDelay for the
+// given host, or zero if there is none.
+func (s *ChallSrv) GetTLSALPNDelay(host string) time.Duration {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.delays[host]
+}
+
+// SetTLSALPNValidity sets the NotBefore and NotAfter dates of TLS-ALPN-01
+// challenge certificates issued for the given host. This is useful for testing
+// validator behavior against expired or not yet valid challenge certificates.
+// Use zero values for both dates to go back to the default validity window.
+func (s *ChallSrv) SetTLSALPNValidity(host string, notBefore, notAfter time.Time) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if notBefore.IsZero() && notAfter.IsZero() {
+		delete(s.tlsALPNMocks.validity, host)
+		return
+	}
+	s.tlsALPNMocks.validity[host] = validityWindow{
+		notBefore: notBefore,
+		notAfter:  notAfter,
+	}
+}
+
+// GetTLSALPNValidity returns the NotBefore and NotAfter dates set with
+// SetTLSALPNValidity for the given host and true. If no validity window has been
+// set zero dates and false are returned.
+func (s *ChallSrv) GetTLSALPNValidity(host string) (time.Time, time.Time, bool) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	window, present := s.tlsALPNMocks.validity[host]
+	return window.notBefore, window.notAfter, present
+}
+
+// SetTLSALPNFailure configures the TLS-ALPN-01 challenge server to fail TLS
+// handshakes for the given host by returning err instead of a challenge
+// certificate, even when a challenge has been added for the host. Use a nil err
+// to stop failing handshakes.
+func (s *ChallSrv) SetTLSALPNFailure(host string, err error) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if err == nil {
+		delete(s.tlsALPNMocks.failures, host)
+		return
+	}
+	s.tlsALPNMocks.failures[host] = err
+}
+
+// GetTLSALPNFailure returns the error set with SetTLSALPNFailure for the given
+// host, or nil if handshakes for the host are not being failed.
+func (s *ChallSrv) GetTLSALPNFailure(host string) error {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.failures[host]
+}
+
+// SetTLSALPNDuplicateExtension configures whether TLS-ALPN-01 challenge
+// certificates issued for the given host include the acmeIdentifier extension
+// twice. Both copies carry the correct digest. RFC 8737 requires exactly one
+// acmeIdentifier extension so this is only useful for testing that validators
+// reject certificates with duplicate extensions.
+func (s *ChallSrv) SetTLSALPNDuplicateExtension(host string, dup bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if !dup {
+		delete(s.tlsALPNMocks.duplicateExtension, host)
+		return
+	}
+	s.tlsALPNMocks.duplicateExtension[host] = true
+}
+
+// GetTLSALPNDuplicateExtension returns true when the chall srv has been
+// configured with SetTLSALPNDuplicateExtension to include the acmeIdentifier
+// extension twice in challenge certificates issued for the given host.
+func (s *ChallSrv) GetTLSALPNDuplicateExtension(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.duplicateExtension[host]
+}
+
+// SetTLSALPNOverrideCert sets a certificate that the TLS-ALPN-01 challenge
+// server presents verbatim for acme-tls/1 handshakes with the given host,
+// instead of generating a challenge certificate. This is useful for presenting
+// arbitrary or deliberately malformed certificates to validators. Use a nil cert
+// to go back to generating challenge certificates.
+func (s *ChallSrv) SetTLSALPNOverrideCert(host string, cert *tls.Certificate) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if cert == nil {
+		delete(s.tlsALPNMocks.overrideCerts, host)
+		return
+	}
+	s.tlsALPNMocks.overrideCerts[host] = cert
+}
+
+// GetTLSALPNOverrideCert returns the certificate set with
+// SetTLSALPNOverrideCert for the given host, or nil if there is none.
+func (s *ChallSrv) GetTLSALPNOverrideCert(host string) *tls.Certificate {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.overrideCerts[host]
+}
+
+// SetTLSALPNMalformedDER sets bytes that the TLS-ALPN-01 challenge server
+// presents as the DER encoded leaf certificate for acme-tls/1 handshakes with
+// the given host, instead of a generated challenge certificate. Unlike
+// SetTLSALPNOverrideCert no key is needed: the handshake is signed with the
+// challenge key so it proceeds far enough for the validator to parse the
+// certificate. This is useful for testing that validators fail gracefully on
+// garbage or truncated DER. Use a nil der to go back to generating challenge
+// certificates.
+func (s *ChallSrv) SetTLSALPNMalformedDER(host string, der []byte) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if der == nil {
+		delete(s.tlsALPNMocks.malformedDER, host)
+		return
+	}
+	s.tlsALPNMocks.malformedDER[host] = append([]byte(nil), der...)
+}
+
+// GetTLSALPNMalformedDER returns the bytes set with SetTLSALPNMalformedDER for
+// the given host, or nil if there are none.
+func (s *ChallSrv) GetTLSALPNMalformedDER(host string) []byte {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.malformedDER[host]
+}
+
+// SetTLSALPNExternalIssuer configures the TLS-ALPN-01 challenge server to sign
+// challenge certificates issued for the given host with the given issuer
+// certificate and key instead of self-signing them. RFC 8737 requires challenge
+// certificates to be self-signed so this is only useful for testing validator
+// behavior against certificates that aren't. Use a nil issuer to go back to
+// self-signed challenge certificates.
+func (s *ChallSrv) SetTLSALPNExternalIssuer(host string, issuer *x509.Certificate, key crypto.Signer) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if issuer == nil || key == nil {
+		delete(s.tlsALPNMocks.issuers, host)
+		return
+	}
+	s.tlsALPNMocks.issuers[host] = tlsALPNIssuer{
+		cert: issuer,
+		key:  key,
+	}
+}
+
+// GetTLSALPNExternalIssuer returns the issuer certificate and key set with
+// SetTLSALPNExternalIssuer for the given host, or nils if challenge
+// certificates for the host are self-signed.
+func (s *ChallSrv) GetTLSALPNExternalIssuer(host string) (*x509.Certificate, crypto.Signer) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	issuer := s.tlsALPNMocks.issuers[host]
+	return issuer.cert, issuer.key
+}
+
+// SetTLSALPNIntermediate sets a DER encoded certificate that is appended to the
+// certificate chain served with TLS-ALPN-01 challenge certificates for the
+// given host. RFC 8737 validators only inspect the leaf certificate so this is
+// useful for testing that an unexpected intermediate is ignored. Use a nil der
+// to serve only the challenge certificate.
+func (s *ChallSrv) SetTLSALPNIntermediate(host string, der []byte) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	if der == nil {
+		delete(s.tlsALPNMocks.intermediates, host)
+		return
+	}
+	s.tlsALPNMocks.intermediates[host] = der
+}
+
+// GetTLSALPNIntermediate returns the DER encoded certificate set with
+// SetTLSALPNIntermediate for the given host, or nil if there is none.
+func (s *ChallSrv) GetTLSALPNIntermediate(host string) []byte {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.intermediates[host]
+}
+
+// SetTLSALPNFallbackCert sets the certificate the TLS-ALPN-01 challenge server
+// presents for TLS handshakes that don't negotiate the acme-tls/1 protocol. This
+// is useful for simulating a regular HTTPS server answering on the port used
+// for TLS-ALPN-01 validation. See GetTLSALPNFallbackCert for how it ranks
+// against the other ways of choosing that certificate. Use an empty
+// tls.Certificate to go back to the ChallSrv's fallback certificate.
+func (s *ChallSrv) SetTLSALPNFallbackCert(cert tls.Certificate) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if len(cert.Certificate) == 0 {
+		s.tlsALPNMocks.fallbackCert = nil
+		return
+	}
+	s.tlsALPNMocks.fallbackCert = &cert
+}
+
+// GetTLSALPNFallbackCert returns the certificate the TLS-ALPN-01 challenge
+// server presents for TLS handshakes that don't negotiate the acme-tls/1
+// protocol and whose SNI value has no certificate set with
+// SetTLSALPNDefaultCertForSNI. It is the first of:
+//
+//   - the certificate set with SetTLSALPNFallbackCert
+//   - the Config's FallbackCert
+//   - a self-signed certificate valid from the Config's FallbackCertNotBefore
+//     until its FallbackCertNotAfter, if either is set
+//   - a self-signed certificate valid from an hour ago until a year from now
+//
+// Only SetTLSALPNFallbackCert is specific to the TLS-ALPN-01 server. The
+// others make up the ChallSrv's fallback certificate, which the HTTPS HTTP-01
+// and DNS-over-HTTPS servers always present and FallbackCertDER returns.
+func (s *ChallSrv) GetTLSALPNFallbackCert() *tls.Certificate {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	if s.tlsALPNMocks.fallbackCert != nil {
+		return s.tlsALPNMocks.fallbackCert
+	}
+	return &s.fallbackCert
+}
+
+// SetTLSALPNDefaultCertForSNI sets the certificate the TLS-ALPN-01 challenge
+// server presents for TLS handshakes with the given SNI value that don't
+// negotiate the acme-tls/1 protocol, instead of the fallback certificate. This
+// is useful for simulating a host that serves different certificates per name
+// on the port used for TLS-ALPN-01 validation. Use an empty tls.Certificate to
+// go back to the fallback certificate.
+func (s *ChallSrv) SetTLSALPNDefaultCertForSNI(sni string, cert tls.Certificate) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	sni = tlsALPNHost(sni)
+	if len(cert.Certificate) == 0 {
+		delete(s.tlsALPNMocks.defaultCerts, sni)
+		return
+	}
+	s.tlsALPNMocks.defaultCerts[sni] = &cert
+}
+
+// GetTLSALPNDefaultCertForSNI returns the certificate set with
+// SetTLSALPNDefaultCertForSNI for the given SNI value, or nil if there is none.
+func (s *ChallSrv) GetTLSALPNDefaultCertForSNI(sni string) *tls.Certificate {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	sni = tlsALPNHost(sni)
+	return s.tlsALPNMocks.defaultCerts[sni]
+}
@@ -0,0 +1,813 @@
+package challtestsrv_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+func TestTLSALPNSerial(t *testing.T) {
+	const host = "serial.example.com"
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	serial := big.NewInt(1234567890)
+	srv.SetTLSALPNSerial(host, serial)
+	for i := 0; i < 2; i++ {
+		state, err := handshakeTLSALPN(srv, host)
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		if got := state.PeerCertificates[0].SerialNumber; got.Cmp(serial) != 0 {
+			t.Errorf("handshake %d: serial = %s, want %s", i, got, serial)
+		}
+	}
+
+	// Without a serial set each certificate gets a fresh random one.
+	srv.SetTLSALPNSerial(host, nil)
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		state, err := handshakeTLSALPN(srv, host)
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		got := state.PeerCertificates[0].SerialNumber
+		if got.Cmp(serial) == 0 || seen[got.String()] {
+			t.Errorf("handshake %d: serial %s was reused after the serial was cleared", i, got)
+		}
+		seen[got.String()] = true
+	}
+}
+
+func TestTLSALPNOmitExtension(t *testing.T) {
+	const host = "omit.example.com"
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	for _, omit := range []bool{true, false} {
+		srv.SetTLSALPNOmitExtension(host, omit)
+		state, err := handshakeTLSALPN(srv, host)
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		wantExts := 1
+		if omit {
+			wantExts = 0
+		}
+		if got := len(acmeIdentifierExtensions(state.PeerCertificates[0])); got != wantExts {
+			t.Errorf("with omit %t: got %d acmeIdentifier extensions, want %d", omit, got, wantExts)
+		}
+	}
+}
+
+func TestTLSALPNExtensionCritical(t *testing.T) {
+	const host = "critical.example.com"
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	for _, critical := range []bool{false, true} {
+		srv.SetTLSALPNExtensionCritical(host, critical)
+		state, err := handshakeTLSALPN(srv, host)
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		exts := acmeIdentifierExtensions(state.PeerCertificates[0])
+		if len(exts) != 1 {
+			t.Fatalf("got %d acmeIdentifier extensions, want 1", len(exts))
+		}
+		if exts[0].Critical != critical {
+			t.Errorf("acmeIdentifier extension Critical = %t, want %t", exts[0].Critical, critical)
+		}
+	}
+}
+
+func TestTLSALPNIsCA(t *testing.T) {
+	const host = "ca.example.com"
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	for _, isCA := range []bool{true, false} {
+		srv.SetTLSALPNIsCA(host, isCA)
+		if got := srv.GetTLSALPNIsCA(host); got != isCA {
+			t.Errorf("GetTLSALPNIsCA = %t, want %t", got, isCA)
+		}
+		state, err := handshakeTLSALPN(srv, host)
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		cert := state.PeerCertificates[0]
+		// Without the mock there are no basic constraints at all.
+		if cert.IsCA != isCA || cert.BasicConstraintsValid != isCA {
+			t.Errorf("with isCA %t: IsCA = %t and BasicConstraintsValid = %t, want both %t",
+				isCA, cert.IsCA, cert.BasicConstraintsValid, isCA)
+		}
+	}
+}
+
+func TestTLSALPNExtraSANs(t *testing.T) {
+	const host = "multi-san.example.com"
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	testCases := []struct {
+		name      string
+		extraSANs []string
+		wantSANs  []string
+	}{
+		{
+			name:      "extra SANs",
+			extraSANs: []string{"a.example.com", "b.example.com"},
+			wantSANs:  []string{host, "a.example.com", "b.example.com"},
+		},
+		{name: "cleared", wantSANs: []string{host}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.SetTLSALPNExtraSANs(host, tc.extraSANs)
+			state, err := handshakeTLSALPN(srv, host)
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			if got := state.PeerCertificates[0].DNSNames; !reflect.DeepEqual(got, tc.wantSANs) {
+				t.Errorf("certificate DNSNames = %q, want %q", got, tc.wantSANs)
+			}
+		})
+	}
+}
+
+func TestTLSALPNDelay(t *testing.T) {
+	const host = "slow.example.com"
+	const delay = 200 * time.Millisecond
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	srv.SetTLSALPNDelay(host, delay)
+
+	start := time.Now()
+	if _, err := handshakeTLSALPN(srv, host); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("handshake took %s, want at least the %s delay", elapsed, delay)
+	}
+
+	// A client giving up during the delay ends it early.
+	srv.SetTLSALPNDelay(host, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), delay)
+	defer cancel()
+	start = time.Now()
+	_, err := srv.TLSALPNHandshake(ctx, &tls.Config{
+		ServerName:         host,
+		NextProtos:         []string{challtestsrv.ACMETLS1Protocol},
+		InsecureSkipVerify: true,
+	})
+	if err == nil {
+		t.Error("handshake succeeded after the client gave up")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("abandoned handshake took %s, want the delay cut short", elapsed)
+	}
+
+	// Other hosts aren't delayed.
+	srv.AddTLSALPNChallenge("fast.example.com", "key-authorization")
+	start = time.Now()
+	if _, err := handshakeTLSALPN(srv, "fast.example.com"); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("handshake for a host without a delay took %s", elapsed)
+	}
+}
+
+func TestTLSALPNValidity(t *testing.T) {
+	const host = "expired.example.com"
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	srv.SetTLSALPNValidity(host, notBefore, notAfter)
+	state, err := handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	cert := state.PeerCertificates[0]
+	if !cert.NotBefore.Equal(notBefore) || !cert.NotAfter.Equal(notAfter) {
+		t.Errorf("certificate is valid from %s to %s, want %s to %s",
+			cert.NotBefore, cert.NotAfter, notBefore, notAfter)
+	}
+
+	// Clearing the window goes back to a certificate valid now.
+	srv.SetTLSALPNValidity(host, time.Time{}, time.Time{})
+	state, err = handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	cert = state.PeerCertificates[0]
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		t.Errorf("certificate is valid from %s to %s, want it valid now", cert.NotBefore, cert.NotAfter)
+	}
+}
+
+func TestTLSALPNFailure(t *testing.T) {
+	const host = "failing.example.com"
+	errHandshake := errors.New("injected handshake failure")
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getCert := srv.ServeChallengeCertFunc(key)
+	hello := &tls.ClientHelloInfo{
+		ServerName:      host,
+		SupportedProtos: []string{challtestsrv.ACMETLS1Protocol},
+	}
+
+	srv.SetTLSALPNFailure(host, errHandshake)
+	if _, err := getCert(hello); !errors.Is(err, errHandshake) {
+		t.Errorf("GetCertificate returned %v, want the injected error", err)
+	}
+	if _, err := handshakeTLSALPN(srv, host); err == nil {
+		t.Error("handshake succeeded with a failure injected")
+	}
+
+	srv.SetTLSALPNFailure(host, nil)
+	if _, err := getCert(hello); err != nil {
+		t.Errorf("GetCertificate returned %v after the failure was removed", err)
+	}
+
+	// Names without a challenge fail with ErrUnknownSNI.
+	hello.ServerName = "unknown.example.com"
+	if _, err := getCert(hello); !errors.Is(err, challtestsrv.ErrUnknownSNI) {
+		t.Errorf("GetCertificate for an unknown name returned %v, want ErrUnknownSNI", err)
+	}
+}
+
+func TestTLSALPNFallbackCertPrecedence(t *testing.T) {
+	newCert := func(t *testing.T, name string) tls.Certificate {
+		t.Helper()
+		cert, err := challtestsrv.NewSelfSignedCert(elliptic.P256(), func(template *x509.Certificate) {
+			template.Subject.CommonName = name
+		})
+		if err != nil {
+			t.Fatalf("issuing %s certificate: %s", name, err)
+		}
+		return cert
+	}
+	configCert := newCert(t, "config")
+
+	testCases := []struct {
+		name     string
+		config   challtestsrv.Config
+		fallback string
+		sniCert  string
+		want     string
+	}{
+		{name: "self-signed", want: "challenge test server"},
+		{
+			name:   "self-signed with validity",
+			config: challtestsrv.Config{FallbackCertNotAfter: time.Now().Add(time.Hour)},
+			want:   "challenge test server",
+		},
+		{name: "config", config: challtestsrv.Config{FallbackCert: &configCert}, want: "config"},
+		{
+			name:     "SetTLSALPNFallbackCert over config",
+			config:   challtestsrv.Config{FallbackCert: &configCert},
+			fallback: "set",
+			want:     "set",
+		},
+		{
+			name:     "SNI certificate over everything",
+			config:   challtestsrv.Config{FallbackCert: &configCert},
+			fallback: "set",
+			sniCert:  "sni",
+			want:     "sni",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, tc.config)
+			if tc.fallback != "" {
+				srv.SetTLSALPNFallbackCert(newCert(t, tc.fallback))
+			}
+			if tc.sniCert != "" {
+				srv.SetTLSALPNDefaultCertForSNI("example.com", newCert(t, tc.sniCert))
+			}
+
+			// A handshake without ALPN never gets a challenge certificate.
+			state, err := handshakeProtos(srv, "example.com")
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			if got := state.PeerCertificates[0].Subject.CommonName; got != tc.want {
+				t.Errorf("got the %q certificate, want %q", got, tc.want)
+			}
+
+			// The HTTPS servers always use the ChallSrv's fallback certificate.
+			der := srv.FallbackCertDER()
+			if tc.config.FallbackCert != nil && !bytes.Equal(der, tc.config.FallbackCert.Certificate[0]) {
+				t.Error("FallbackCertDER isn't the Config's FallbackCert")
+			}
+			if tc.fallback == "" && tc.sniCert == "" && !bytes.Equal(der, state.PeerCertificates[0].Raw) {
+				t.Error("FallbackCertDER isn't the certificate the TLS-ALPN-01 server presented")
+			}
+		})
+	}
+
+	// An empty certificate goes back to the ChallSrv's fallback certificate.
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{FallbackCert: &configCert})
+	srv.SetTLSALPNFallbackCert(newCert(t, "set"))
+	srv.SetTLSALPNFallbackCert(tls.Certificate{})
+	state, err := handshakeProtos(srv, "example.com")
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if got := state.PeerCertificates[0].Subject.CommonName; got != "config" {
+		t.Errorf("got the %q certificate after clearing SetTLSALPNFallbackCert, want %q", got, "config")
+	}
+}
+
+func TestTLSALPNDuplicateExtension(t *testing.T) {
+	const host = "duplicate.example.com"
+	oid, err := asn1.Marshal(challtestsrv.IDPeAcmeIdentifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	for _, dup := range []bool{true, false} {
+		srv.SetTLSALPNDuplicateExtension(host, dup)
+		_, err := handshakeTLSALPN(srv, host)
+		// Go's TLS client refuses to parse a certificate with duplicate
+		// extensions, so the certificate is checked with LastTLSALPNCert.
+		if dup && err == nil {
+			t.Error("handshake succeeded with a duplicate acmeIdentifier extension")
+		}
+		if !dup && err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		der, found := srv.LastTLSALPNCert(host)
+		if !found {
+			t.Fatal("no challenge certificate was generated")
+		}
+		want := 1
+		if dup {
+			want = 2
+		}
+		if got := bytes.Count(der, oid); got != want {
+			t.Errorf("with duplicate %t: certificate has %d acmeIdentifier extensions, want %d", dup, got, want)
+		}
+	}
+}
+
+func TestTLSALPNOverrideCert(t *testing.T) {
+	const host = "override.example.com"
+	override, err := challtestsrv.NewSelfSignedCert(elliptic.P256(), func(template *x509.Certificate) {
+		template.Subject.CommonName = "override"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.SetTLSALPNOverrideCert(host, &override)
+
+	// The override is served even without a challenge for the host.
+	state, err := handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if !bytes.Equal(state.PeerCertificates[0].Raw, override.Certificate[0]) {
+		t.Errorf("got certificate %q, want the override", state.PeerCertificates[0].Subject.CommonName)
+	}
+	// Only for the host it was set for.
+	srv.AddTLSALPNChallenge("other.example.com", "key-authorization")
+	state, err = handshakeTLSALPN(srv, "other.example.com")
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if bytes.Equal(state.PeerCertificates[0].Raw, override.Certificate[0]) {
+		t.Error("another host got the override certificate")
+	}
+
+	srv.SetTLSALPNOverrideCert(host, nil)
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	state, err = handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if len(acmeIdentifierExtensions(state.PeerCertificates[0])) != 1 {
+		t.Error("didn't get a challenge certificate after removing the override")
+	}
+}
+
+// newTestCA returns a self-signed CA certificate and its key.
+func newTestCA(t *testing.T, name string) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	ca, err := challtestsrv.NewSelfSignedCert(elliptic.P256(), func(template *x509.Certificate) {
+		template.Subject.CommonName = name
+	})
+	if err != nil {
+		t.Fatalf("issuing %s certificate: %s", name, err)
+	}
+	cert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing %s certificate: %s", name, err)
+	}
+	return cert, ca.PrivateKey.(crypto.Signer)
+}
+
+func TestTLSALPNExternalIssuer(t *testing.T) {
+	const host = "issued.example.com"
+	issuer, issuerKey := newTestCA(t, "issuer")
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	srv.SetTLSALPNExternalIssuer(host, issuer, issuerKey)
+
+	state, err := handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	cert := state.PeerCertificates[0]
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		t.Errorf("challenge certificate isn't signed by the issuer: %s", err)
+	}
+	if cert.Issuer.CommonName != "issuer" {
+		t.Errorf("challenge certificate issuer = %q, want %q", cert.Issuer.CommonName, "issuer")
+	}
+	if len(acmeIdentifierExtensions(cert)) != 1 {
+		t.Error("challenge certificate issued by the issuer has no acmeIdentifier extension")
+	}
+
+	srv.SetTLSALPNExternalIssuer(host, nil, nil)
+	state, err = handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if err := state.PeerCertificates[0].CheckSignatureFrom(issuer); err == nil {
+		t.Error("challenge certificate is still signed by the issuer after removing it")
+	}
+}
+
+func TestTLSALPNIntermediate(t *testing.T) {
+	const host = "chain.example.com"
+	intermediate, _ := newTestCA(t, "intermediate")
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	srv.SetTLSALPNIntermediate(host, intermediate.Raw)
+
+	state, err := handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if len(state.PeerCertificates) != 2 {
+		t.Fatalf("got a chain of %d certificates, want 2", len(state.PeerCertificates))
+	}
+	if len(acmeIdentifierExtensions(state.PeerCertificates[0])) != 1 {
+		t.Error("the leaf isn't the challenge certificate")
+	}
+	if !bytes.Equal(state.PeerCertificates[1].Raw, intermediate.Raw) {
+		t.Errorf("second certificate is %q, want the intermediate", state.PeerCertificates[1].Subject.CommonName)
+	}
+
+	srv.SetTLSALPNIntermediate(host, nil)
+	state, err = handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if len(state.PeerCertificates) != 1 {
+		t.Errorf("got a chain of %d certificates after removing the intermediate, want 1", len(state.PeerCertificates))
+	}
+}
+
+func TestTLSALPNWrongSAN(t *testing.T) {
+	const host = "right.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	want := sha256.Sum256([]byte("key-authorization"))
+
+	testCases := []struct {
+		name     string
+		wrongSAN string
+		wantDNS  []string
+		wantIPs  []string
+	}{
+		{name: "DNS name", wrongSAN: "wrong.example.com", wantDNS: []string{"wrong.example.com"}},
+		{name: "IP address", wrongSAN: "192.0.2.1", wantIPs: []string{"192.0.2.1"}},
+		{name: "removed", wantDNS: []string{host}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.SetTLSALPNWrongSAN(host, tc.wrongSAN)
+			if got := srv.GetTLSALPNWrongSAN(host); got != tc.wrongSAN {
+				t.Errorf("GetTLSALPNWrongSAN = %q, want %q", got, tc.wrongSAN)
+			}
+			state, err := handshakeTLSALPN(srv, host)
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			cert := state.PeerCertificates[0]
+			if !reflect.DeepEqual(cert.DNSNames, tc.wantDNS) {
+				t.Errorf("DNS SANs = %q, want %q", cert.DNSNames, tc.wantDNS)
+			}
+			var ips []string
+			for _, ip := range cert.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+			if !reflect.DeepEqual(ips, tc.wantIPs) {
+				t.Errorf("IP SANs = %q, want %q", ips, tc.wantIPs)
+			}
+			// The digest is still correct.
+			if digest := acmeIdentifierDigest(t, cert); !bytes.Equal(digest, want[:]) {
+				t.Errorf("acmeIdentifier digest = %x, want %x", digest, want)
+			}
+		})
+	}
+}
+
+func TestTLSALPNFlakyUntil(t *testing.T) {
+	const host = "flaky.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	srv.SetTLSALPNFlakyUntil(host, 3)
+	for i := 1; i <= 4; i++ {
+		_, err := handshakeTLSALPN(srv, host)
+		if wantErr := i < 3; (err != nil) != wantErr {
+			t.Errorf("handshake %d error = %v, want error %t", i, err, wantErr)
+		}
+	}
+
+	// Setting it again restarts the count.
+	srv.SetTLSALPNFlakyUntil(host, 2)
+	if _, err := handshakeTLSALPN(srv, host); err == nil {
+		t.Error("first handshake after restarting the count succeeded")
+	}
+	if _, err := handshakeTLSALPN(srv, host); err != nil {
+		t.Errorf("second handshake after restarting the count failed: %s", err)
+	}
+
+	srv.SetTLSALPNFlakyUntil(host, 2)
+	srv.SetTLSALPNFlakyUntil(host, 0)
+	if _, err := handshakeTLSALPN(srv, host); err != nil {
+		t.Errorf("handshake after removing the failures failed: %s", err)
+	}
+}
+
+func TestTLSALPNRawHash(t *testing.T) {
+	const host = "raw.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	want := sha256.Sum256([]byte("key-authorization"))
+
+	srv.SetTLSALPNRawHash(host, true)
+	if !srv.GetTLSALPNRawHash(host) {
+		t.Error("GetTLSALPNRawHash = false after SetTLSALPNRawHash(true)")
+	}
+	state, err := handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	exts := acmeIdentifierExtensions(state.PeerCertificates[0])
+	if len(exts) != 1 {
+		t.Fatalf("got %d acmeIdentifier extensions, want 1", len(exts))
+	}
+	if !bytes.Equal(exts[0].Value, want[:]) {
+		t.Errorf("acmeIdentifier value = %x, want the bare digest %x", exts[0].Value, want)
+	}
+
+	srv.SetTLSALPNRawHash(host, false)
+	state, err = handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if digest := acmeIdentifierDigest(t, state.PeerCertificates[0]); !bytes.Equal(digest, want[:]) {
+		t.Errorf("acmeIdentifier digest after clearing the raw hash = %x, want %x", digest, want)
+	}
+}
+
+func TestTLSALPNAlert(t *testing.T) {
+	const host = "alert.example.com"
+	testCases := []struct {
+		name   string
+		alert  challtestsrv.TLSALPNAlert
+		protos []string
+		// wantErr is the error the client gets, or "" if the handshake
+		// completes with the fallback certificate.
+		wantErr string
+	}{
+		{
+			name:    "unrecognized_name with acme-tls/1",
+			alert:   challtestsrv.TLSALPNAlertUnrecognizedName,
+			protos:  []string{challtestsrv.ACMETLS1Protocol},
+			wantErr: "remote error: tls: unrecognized name",
+		},
+		{
+			name:    "unrecognized_name without ALPN",
+			alert:   challtestsrv.TLSALPNAlertUnrecognizedName,
+			wantErr: "remote error: tls: unrecognized name",
+		},
+		{
+			name:    "no_application_protocol with acme-tls/1",
+			alert:   challtestsrv.TLSALPNAlertNoApplicationProtocol,
+			protos:  []string{challtestsrv.ACMETLS1Protocol},
+			wantErr: "remote error: tls: no application protocol",
+		},
+		{
+			name:  "no_application_protocol without ALPN",
+			alert: challtestsrv.TLSALPNAlertNoApplicationProtocol,
+		},
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.SetTLSALPNAlert(host, tc.alert)
+			if got := srv.GetTLSALPNAlert(host); got != tc.alert {
+				t.Errorf("GetTLSALPNAlert = %d, want %d", got, tc.alert)
+			}
+			state, err := handshakeProtos(srv, host, tc.protos...)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("handshake error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			if !bytes.Equal(state.PeerCertificates[0].Raw, srv.FallbackCertDER()) {
+				t.Error("handshake wasn't served the fallback certificate")
+			}
+		})
+	}
+
+	srv.SetTLSALPNAlert(host, challtestsrv.TLSALPNAlertNone)
+	if _, err := handshakeTLSALPN(srv, host); err != nil {
+		t.Errorf("handshake after removing the alert failed: %s", err)
+	}
+}
+
+func TestTLSALPNBadSignature(t *testing.T) {
+	const host = "badsig.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	for _, bad := range []bool{true, false} {
+		srv.SetTLSALPNBadSignature(host, bad)
+		// The handshake succeeds either way since the server holds the
+		// certificate's key.
+		state, err := handshakeTLSALPN(srv, host)
+		if err != nil {
+			t.Fatalf("handshake with a bad signature %t failed: %s", bad, err)
+		}
+		cert := state.PeerCertificates[0]
+		err = cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+		if bad && err == nil {
+			t.Error("self-signature verifies with SetTLSALPNBadSignature(true)")
+		}
+		if !bad && err != nil {
+			t.Errorf("self-signature doesn't verify after SetTLSALPNBadSignature(false): %s", err)
+		}
+	}
+}
+
+func TestTLSALPNMalformedDER(t *testing.T) {
+	const host = "malformed.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	garbage := []byte{0x30, 0x82, 0xff, 0xff, 0x01}
+	srv.SetTLSALPNMalformedDER(host, garbage)
+	if got := srv.GetTLSALPNMalformedDER(host); !bytes.Equal(got, garbage) {
+		t.Errorf("GetTLSALPNMalformedDER = %x, want %x", got, garbage)
+	}
+	// The client gets as far as parsing the certificate.
+	_, err := handshakeTLSALPN(srv, host)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse certificate") {
+		t.Errorf("handshake error = %v, want a certificate parsing error", err)
+	}
+
+	srv.SetTLSALPNMalformedDER(host, nil)
+	if _, err := handshakeTLSALPN(srv, host); err != nil {
+		t.Errorf("handshake after removing the malformed DER failed: %s", err)
+	}
+}
+
+func TestTLSALPNDefaultCertForSNI(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge("named.example.com", "key-authorization")
+	named, err := challtestsrv.NewSelfSignedCert(elliptic.P256(), nil)
+	if err != nil {
+		t.Fatalf("issuing certificate: %s", err)
+	}
+	srv.SetTLSALPNDefaultCertForSNI("Named.Example.com", named)
+
+	testCases := []struct {
+		name string
+		sni  string
+		want []byte
+	}{
+		{name: "named SNI without ALPN", sni: "named.example.com", want: named.Certificate[0]},
+		{name: "other SNI without ALPN", sni: "other.example.com", want: srv.FallbackCertDER()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := handshakeProtos(srv, tc.sni)
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			if !bytes.Equal(state.PeerCertificates[0].Raw, tc.want) {
+				t.Errorf("handshake for %q was served the wrong certificate", tc.sni)
+			}
+		})
+	}
+
+	// acme-tls/1 handshakes still get a challenge certificate.
+	state, err := handshakeTLSALPN(srv, "named.example.com")
+	if err != nil {
+		t.Fatalf("acme-tls/1 handshake failed: %s", err)
+	}
+	if len(acmeIdentifierExtensions(state.PeerCertificates[0])) != 1 {
+		t.Error("acme-tls/1 handshake wasn't served a challenge certificate")
+	}
+
+	srv.SetTLSALPNDefaultCertForSNI("named.example.com", tls.Certificate{})
+	if cert := srv.GetTLSALPNDefaultCertForSNI("named.example.com"); cert != nil {
+		t.Error("GetTLSALPNDefaultCertForSNI returned a certificate after it was removed")
+	}
+	state, err = handshakeProtos(srv, "named.example.com")
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if !bytes.Equal(state.PeerCertificates[0].Raw, srv.FallbackCertDER()) {
+		t.Error("handshake after removing the SNI certificate wasn't served the fallback certificate")
+	}
+}
+
+func TestTLSALPNExtensionOID(t *testing.T) {
+	const host = "oid.example.com"
+	wrongOID := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 99}
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+	want, err := challtestsrv.TLSALPNAcmeIdentifierValue("key-authorization")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SetTLSALPNExtensionOID(host, wrongOID)
+	state, err := handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	cert := state.PeerCertificates[0]
+	if exts := acmeIdentifierExtensions(cert); len(exts) != 0 {
+		t.Errorf("got %d extensions with the acmeIdentifier OID, want none", len(exts))
+	}
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(wrongOID) {
+			found = true
+			if !bytes.Equal(ext.Value, want) {
+				t.Errorf("extension value = %x, want the unchanged acmeIdentifier value %x", ext.Value, want)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("certificate has no extension with the OID %s", wrongOID)
+	}
+
+	srv.SetTLSALPNExtensionOID(host, nil)
+	state, err = handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if exts := acmeIdentifierExtensions(state.PeerCertificates[0]); len(exts) != 1 {
+		t.Errorf("got %d acmeIdentifier extensions after removing the OID, want 1", len(exts))
+	}
+}
@@ -0,0 +1,79 @@
+package challtestsrv
+
+import (
+	"crypto/elliptic"
+	"crypto/tls"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// An Option modifies the Config passed to New before it is validated and its
+// defaults are applied. Options are applied in order, so later options win.
+type Option func(*Config)
+
+// WithLogger sets the Config's Log.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Config) {
+		c.Log = logger
+	}
+}
+
+// WithStats sets the Config's Stats.
+func WithStats(stats prometheus.Registerer) Option {
+	return func(c *Config) {
+		c.Stats = stats
+	}
+}
+
+// WithTLSALPNKeyType sets the Config's TLSALPNKeyType.
+func WithTLSALPNKeyType(typ TLSALPNKeyType) Option {
+	return func(c *Config) {
+		c.TLSALPNKeyType = typ
+	}
+}
+
+// WithFallbackCert sets the Config's FallbackCert.
+func WithFallbackCert(cert *tls.Certificate) Option {
+	return func(c *Config) {
+		c.FallbackCert = cert
+	}
+}
+
+// WithFallbackCertValidity sets the Config's FallbackCertNotBefore and
+// FallbackCertNotAfter.
+func WithFallbackCertValidity(notBefore, notAfter time.Time) Option {
+	return func(c *Config) {
+		c.FallbackCertNotBefore = notBefore
+		c.FallbackCertNotAfter = notAfter
+	}
+}
+
+// WithTLSALPNCurve sets the Config's TLSALPNCurve.
+func WithTLSALPNCurve(curve elliptic.Curve) Option {
+	return func(c *Config) {
+		c.TLSALPNCurve = curve
+	}
+}
+
+// WithTLSALPNReadTimeout sets the Config's TLSALPNReadTimeout.
+func WithTLSALPNReadTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.TLSALPNReadTimeout = d
+	}
+}
+
+// WithTLSALPNWriteTimeout sets the Config's TLSALPNWriteTimeout.
+func WithTLSALPNWriteTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.TLSALPNWriteTimeout = d
+	}
+}
+
+// WithTLSALPNStrictProtocol sets the Config's TLSALPNStrictProtocol.
+func WithTLSALPNStrictProtocol(strict bool) Option {
+	return func(c *Config) {
+		c.TLSALPNStrictProtocol = &strict
+	}
+}
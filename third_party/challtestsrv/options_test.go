@@ -0,0 +1,63 @@
+package challtestsrv_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+)
+
+func TestNewOptions(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	srv, err := challtestsrv.New(challtestsrv.Config{
+		TLSALPNOneAddrs:    []string{"127.0.0.1:0"},
+		TLSALPNCurve:       elliptic.P521(),
+		TLSALPNReadTimeout: 10 * time.Second,
+	},
+		challtestsrv.WithLogger(log.New(io.Discard, "", 0)),
+		// Options override the Config and later options win.
+		challtestsrv.WithTLSALPNCurve(elliptic.P256()),
+		challtestsrv.WithTLSALPNCurve(elliptic.P384()),
+		challtestsrv.WithTLSALPNReadTimeout(timeout),
+		challtestsrv.WithTLSALPNWriteTimeout(timeout),
+	)
+	if err != nil {
+		t.Fatalf("creating challenge server: %s", err)
+	}
+	srv.Run()
+	defer srv.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitReady(ctx); err != nil {
+		t.Fatalf("waiting for challenge server: %s", err)
+	}
+
+	srv.AddTLSALPNChallenge("example.com", "key-authorization")
+	state, err := handshakeTLSALPN(srv, "example.com")
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	pub, ok := state.PeerCertificates[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P384() {
+		t.Errorf("challenge certificate has a %s key, want P-384", curveName(state.PeerCertificates[0].PublicKey))
+	}
+
+	// The read timeout set by the option closes an idle connection.
+	conn, err := net.Dial("tcp", srv.TLSALPNOneAddr())
+	if err != nil {
+		t.Fatalf("dialing: %s", err)
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read from an idle connection returned %v, want EOF once the option's read timeout is over", err)
+	}
+}
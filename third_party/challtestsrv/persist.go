@@ -0,0 +1,105 @@
+package challtestsrv
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// challengeState is the JSON format of the file written by SaveChallenges. It
+// is kept separate from Snapshot so that changes to the WithChallenges API
+// don't change the format of existing state files.
+type challengeState struct {
+	// HTTPOne is a map of HTTP-01 token to key authorization.
+	HTTPOne map[string]string `json:"httpOne"`
+	// DNSOne is a map of DNS-01 host to TXT record values.
+	DNSOne map[string][]string `json:"dnsOne"`
+	// TLSALPNOne is a map of TLS-ALPN-01 host to key authorization.
+	TLSALPNOne map[string]string `json:"tlsALPNOne"`
+	// TLSALPNPerSource is a map of TLS-ALPN-01 host to a map of client IP
+	// address to key authorization.
+	TLSALPNPerSource map[string]map[string]string `json:"tlsALPNPerSource"`
+}
+
+// SaveChallenges writes all of the HTTP-01, DNS-01 and TLS-ALPN-01 challenges
+// currently added to the challenge server, including those added with
+// AddTLSALPNChallengePerSource, to the given file as JSON. The file
+// is written to a temporary file in the same directory first and then renamed
+// into place so a crash mid-write never leaves a truncated file behind.
+func (s *ChallSrv) SaveChallenges(path string) error {
+	s.challMu.RLock()
+	data, err := json.Marshal(challengeState{
+		HTTPOne:          s.httpOne,
+		DNSOne:           s.dnsOne,
+		TLSALPNOne:       s.tlsALPNOne,
+		TLSALPNPerSource: s.tlsALPNPerSource,
+	})
+	s.challMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadChallenges adds the challenges stored in the given file by SaveChallenges
+// to the challenge server. Challenges already added for the same token or host
+// are replaced. TLS-ALPN-01 hosts and client addresses are normalized like they
+// are by AddTLSALPNChallenge and AddTLSALPNChallengePerSource.
+func (s *ChallSrv) LoadChallenges(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var state challengeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	s.challMu.Lock()
+	for token, keyAuth := range state.HTTPOne {
+		s.httpOne[token] = keyAuth
+	}
+	for host, values := range state.DNSOne {
+		s.dnsOne[host] = values
+	}
+	for host, keyAuth := range state.TLSALPNOne {
+		s.tlsALPNOne[tlsALPNHost(host)] = keyAuth
+	}
+	for host, bySourceIP := range state.TLSALPNPerSource {
+		s.tlsALPNPerSource[tlsALPNHost(host)] = tlsALPNSources(bySourceIP)
+	}
+	s.challMu.Unlock()
+	// Only save once the file was loaded, so that a file that can't be read
+	// isn't replaced.
+	s.saveChallengeState()
+	return nil
+}
+
+// saveChallengeState saves the challenges to the Config's ChallengeStateFile,
+// if there is one, so that they survive the process exiting without a
+// Shutdown. Methods that change challenges defer it before taking challMu so
+// that it runs once the lock is released. Saves are serialized by stateMu so
+// that a save of older challenges can't replace the file after a newer one.
+func (s *ChallSrv) saveChallengeState() {
+	if s.stateFile == "" {
+		return
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if err := s.SaveChallenges(s.stateFile); err != nil {
+		s.log.Printf("err saving challenge state: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,154 @@
+package challtestsrv_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+// TestChallengeStateFileSavedOnChange checks that challenges are saved to the
+// state file as they change, without the server being shut down, so that a new
+// server started with the same file after a crash gets them back.
+func TestChallengeStateFileSavedOnChange(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	cfg := challtestsrv.Config{ChallengeStateFile: stateFile}
+	srv, _ := challtestsrvtest.NewTestServer(t, cfg)
+
+	testCases := []struct {
+		name     string
+		change   func()
+		wantHTTP bool
+		wantDNS  bool
+		wantTLS  bool
+	}{
+		{
+			name: "added",
+			change: func() {
+				srv.AddHTTPOneChallenge("token", "http")
+				srv.AddDNSOneChallenge("_acme-challenge.example.com.", "dns")
+				srv.AddTLSALPNChallenge("example.com", "tls")
+			},
+			wantHTTP: true,
+			wantDNS:  true,
+			wantTLS:  true,
+		},
+		{
+			name: "some deleted",
+			change: func() {
+				srv.DeleteHTTPOneChallenge("token")
+				srv.DeleteTLSALPNChallenge("example.com")
+			},
+			wantDNS: true,
+		},
+		{
+			name: "changed in a batch",
+			change: func() {
+				srv.WithChallenges(func(s *challtestsrv.Snapshot) {
+					s.HTTPOne["token"] = "http"
+					s.DNSOne = nil
+				})
+			},
+			wantHTTP: true,
+		},
+		{
+			name:   "all deleted",
+			change: srv.DeleteAllChallenges,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.change()
+
+			// srv is still running, as if it had crashed rather than been
+			// shut down.
+			restarted, _ := challtestsrvtest.NewTestServer(t, cfg)
+			_, gotHTTP := restarted.GetHTTPOneChallenge("token")
+			gotDNS := len(restarted.GetDNSOneChallenge("_acme-challenge.example.com.")) > 0
+			_, gotTLS := restarted.GetTLSALPNChallenge("example.com")
+			if gotHTTP != tc.wantHTTP || gotDNS != tc.wantDNS || gotTLS != tc.wantTLS {
+				t.Errorf("restarted server has HTTP-01 %t, DNS-01 %t, TLS-ALPN-01 %t challenges, want %t, %t, %t",
+					gotHTTP, gotDNS, gotTLS, tc.wantHTTP, tc.wantDNS, tc.wantTLS)
+			}
+		})
+	}
+}
+
+// TestLoadChallengesNormalizesTLSALPNHosts checks that TLS-ALPN-01 hosts in
+// a state file that wasn't written by SaveChallenges, e.g. one written by hand,
+// are normalized like they are by AddTLSALPNChallenge.
+func TestLoadChallengesNormalizesTLSALPNHosts(t *testing.T) {
+	testCases := []struct {
+		name string
+		host string
+	}{
+		{name: "mixed case", host: "Example.COM"},
+		{name: "trailing dot", host: "example.com."},
+		{name: "mixed case and trailing dot", host: "EXAMPLE.com."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stateFile := filepath.Join(t.TempDir(), "state.json")
+			state := `{"tlsALPNOne": {"` + tc.host + `": "tls"}}`
+			if err := os.WriteFile(stateFile, []byte(state), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			if err := srv.LoadChallenges(stateFile); err != nil {
+				t.Fatalf("loading challenges: %s", err)
+			}
+			if _, err := handshakeTLSALPN(srv, "example.com"); err != nil {
+				t.Errorf("handshake for example.com after loading %q failed: %s", tc.host, err)
+			}
+		})
+	}
+}
+
+// TestUnreadableChallengeStateFileKept checks that a state file that can't be
+// loaded fails New and isn't replaced with the new server's empty state.
+func TestUnreadableChallengeStateFileKept(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	const corrupt = `{"httpOne": `
+	if err := os.WriteFile(stateFile, []byte(corrupt), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := challtestsrv.New(challtestsrv.Config{
+		HTTPOneAddrs:       []string{"127.0.0.1:0"},
+		ChallengeStateFile: stateFile,
+	})
+	if err == nil {
+		t.Fatal("New with a corrupt state file succeeded")
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != corrupt {
+		t.Errorf("state file was changed to %q", data)
+	}
+}
+
+// TestChallengeStateFilePerSource checks that TLS-ALPN-01 key authorizations
+// added with AddTLSALPNChallengePerSource are saved to the state file.
+func TestChallengeStateFilePerSource(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	cfg := challtestsrv.Config{ChallengeStateFile: stateFile}
+	srv, _ := challtestsrvtest.NewTestServer(t, cfg)
+	srv.AddTLSALPNChallengePerSource("Split.example.com", map[string]string{"::ffff:127.0.0.1": "first"})
+
+	restarted, _ := challtestsrvtest.NewTestServer(t, cfg)
+	var got map[string]map[string]string
+	restarted.WithChallenges(func(s *challtestsrv.Snapshot) {
+		got = map[string]map[string]string{}
+		for host, bySource := range s.TLSALPNPerSource {
+			got[host] = bySource
+		}
+	})
+	want := map[string]map[string]string{"split.example.com": {"127.0.0.1": "first"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restarted server has per-source challenges %v, want %v", got, want)
+	}
+}
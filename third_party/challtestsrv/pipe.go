@@ -0,0 +1,47 @@
+package challtestsrv
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// TLSALPNHandshake performs a TLS handshake with the ChallSrv's TLS-ALPN-01
+// challenge server over an in-memory net.Pipe instead of a real socket, and
+// returns the client side connection state. The server side uses the same
+// tls.Config as the first TLS-ALPN-01 challenge server so the handshake gets
+// the same certificates, mocks and events as one made over the network, but no
+// port needs to be bound or dialed. clientConfig should set ServerName and
+// NextProtos, e.g. to the SNI of a challenge and acme-tls/1. The connection is
+// closed once the handshake is done.
+func (s *ChallSrv) TLSALPNHandshake(ctx context.Context, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	var serverConfig *tls.Config
+	for _, srv := range s.serversByKind[tlsALPNServerKind] {
+		if srv, ok := srv.(challTLSServer); ok {
+			serverConfig = srv.TLSConfig
+			break
+		}
+	}
+	if serverConfig == nil {
+		return tls.ConnectionState{}, errors.New("no TLS-ALPN-01 challenge server is configured")
+	}
+
+	clientPipe, serverPipe := net.Pipe()
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		defer serverPipe.Close()
+		// Handshake errors are reported to the client as alerts.
+		_ = tls.Server(serverPipe, serverConfig).HandshakeContext(ctx)
+	}()
+
+	client := tls.Client(clientPipe, clientConfig)
+	err := client.HandshakeContext(ctx)
+	state := client.ConnectionState()
+	// Closing the client side unblocks the server if it is still writing, e.g.
+	// TLS 1.3 session tickets the client never reads.
+	clientPipe.Close()
+	<-serverDone
+	return state, err
+}
@@ -0,0 +1,68 @@
+package challtestsrv_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+func TestTLSALPNHandshake(t *testing.T) {
+	const host = "pipe.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	clientConfig := &tls.Config{
+		ServerName:         host,
+		NextProtos:         []string{challtestsrv.ACMETLS1Protocol},
+		InsecureSkipVerify: true,
+	}
+	state, err := srv.TLSALPNHandshake(ctx, clientConfig)
+	if err != nil {
+		t.Fatalf("in-memory handshake failed: %s", err)
+	}
+	if state.NegotiatedProtocol != challtestsrv.ACMETLS1Protocol {
+		t.Errorf("negotiated protocol = %q, want %q", state.NegotiatedProtocol, challtestsrv.ACMETLS1Protocol)
+	}
+	want := sha256.Sum256([]byte("key-authorization"))
+	if digest := acmeIdentifierDigest(t, state.PeerCertificates[0]); !bytes.Equal(digest, want[:]) {
+		t.Errorf("acmeIdentifier digest = %x, want %x", digest, want)
+	}
+
+	// The certificate is the one served over the network.
+	netState, err := dialTLS("tcp", srv.TLSALPNOneAddr(), host, challtestsrv.ACMETLS1Protocol)
+	if err != nil {
+		t.Fatalf("handshake over the network failed: %s", err)
+	}
+	if pub := netState.PeerCertificates[0].PublicKey.(*ecdsa.PublicKey); !pub.Equal(state.PeerCertificates[0].PublicKey) {
+		t.Error("in-memory and network handshakes got challenge certificates with different keys")
+	}
+	if !bytes.Equal(acmeIdentifierDigest(t, netState.PeerCertificates[0]), want[:]) {
+		t.Error("in-memory and network handshakes got different acmeIdentifier digests")
+	}
+
+	// A cancelled context aborts the handshake.
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if _, err := srv.TLSALPNHandshake(cancelled, clientConfig); err == nil {
+		t.Error("in-memory handshake with a cancelled context succeeded")
+	}
+
+	// Without a TLS-ALPN-01 server there is nothing to hand shake with.
+	noTLS, err := challtestsrv.New(challtestsrv.Config{HTTPOneAddrs: []string{"127.0.0.1:0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = noTLS.TLSALPNHandshake(ctx, clientConfig)
+	if want := "no TLS-ALPN-01 challenge server is configured"; err == nil || err.Error() != want {
+		t.Errorf("TLSALPNHandshake without a TLS-ALPN-01 server = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,560 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.0
+// 	protoc        v3.20.1
+// source: challtestsrv.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Token struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Token string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+}
+
+func (x *Token) Reset() {
+	*x = Token{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_challtestsrv_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Token) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Token) ProtoMessage() {}
+
+func (x *Token) ProtoReflect() protoreflect.Message {
+	mi := &file_challtestsrv_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Token.ProtoReflect.Descriptor instead.
+func (*Token) Descriptor() ([]byte, []int) {
+	return file_challtestsrv_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Token) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type Host struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Host string `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+}
+
+func (x *Host) Reset() {
+	*x = Host{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_challtestsrv_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Host) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Host) ProtoMessage() {}
+
+func (x *Host) ProtoReflect() protoreflect.Message {
+	mi := &file_challtestsrv_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Host.ProtoReflect.Descriptor instead.
+func (*Host) Descriptor() ([]byte, []int) {
+	return file_challtestsrv_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Host) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+type HTTPOneChallenge struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Token   string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Content string `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+}
+
+func (x *HTTPOneChallenge) Reset() {
+	*x = HTTPOneChallenge{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_challtestsrv_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HTTPOneChallenge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HTTPOneChallenge) ProtoMessage() {}
+
+func (x *HTTPOneChallenge) ProtoReflect() protoreflect.Message {
+	mi := &file_challtestsrv_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HTTPOneChallenge.ProtoReflect.Descriptor instead.
+func (*HTTPOneChallenge) Descriptor() ([]byte, []int) {
+	return file_challtestsrv_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *HTTPOneChallenge) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *HTTPOneChallenge) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+type DNSOneChallenge struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Host    string `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Content string `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+}
+
+func (x *DNSOneChallenge) Reset() {
+	*x = DNSOneChallenge{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_challtestsrv_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DNSOneChallenge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSOneChallenge) ProtoMessage() {}
+
+func (x *DNSOneChallenge) ProtoReflect() protoreflect.Message {
+	mi := &file_challtestsrv_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSOneChallenge.ProtoReflect.Descriptor instead.
+func (*DNSOneChallenge) Descriptor() ([]byte, []int) {
+	return file_challtestsrv_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DNSOneChallenge) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *DNSOneChallenge) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+type DNSOneChallenges struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Host     string   `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Contents []string `protobuf:"bytes,2,rep,name=contents,proto3" json:"contents,omitempty"`
+}
+
+func (x *DNSOneChallenges) Reset() {
+	*x = DNSOneChallenges{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_challtestsrv_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DNSOneChallenges) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSOneChallenges) ProtoMessage() {}
+
+func (x *DNSOneChallenges) ProtoReflect() protoreflect.Message {
+	mi := &file_challtestsrv_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSOneChallenges.ProtoReflect.Descriptor instead.
+func (*DNSOneChallenges) Descriptor() ([]byte, []int) {
+	return file_challtestsrv_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DNSOneChallenges) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *DNSOneChallenges) GetContents() []string {
+	if x != nil {
+		return x.Contents
+	}
+	return nil
+}
+
+type TLSALPNChallenge struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Host    string `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Content string `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+}
+
+func (x *TLSALPNChallenge) Reset() {
+	*x = TLSALPNChallenge{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_challtestsrv_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TLSALPNChallenge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TLSALPNChallenge) ProtoMessage() {}
+
+func (x *TLSALPNChallenge) ProtoReflect() protoreflect.Message {
+	mi := &file_challtestsrv_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TLSALPNChallenge.ProtoReflect.Descriptor instead.
+func (*TLSALPNChallenge) Descriptor() ([]byte, []int) {
+	return file_challtestsrv_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TLSALPNChallenge) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *TLSALPNChallenge) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+var File_challtestsrv_proto protoreflect.FileDescriptor
+
+var file_challtestsrv_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0c, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73,
+	0x72, 0x76, 0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22,
+	0x1d, 0x0a, 0x05, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x6b, 0x65,
+	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x22, 0x1a,
+	0x0a, 0x04, 0x48, 0x6f, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x22, 0x42, 0x0a, 0x10, 0x48, 0x54,
+	0x54, 0x50, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x12, 0x14,
+	0x0a, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74,
+	0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x22, 0x3f,
+	0x0a, 0x0f, 0x44, 0x4e, 0x53, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x22,
+	0x42, 0x0a, 0x10, 0x44, 0x4e, 0x53, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e,
+	0x67, 0x65, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x74, 0x65,
+	0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6f, 0x6e, 0x74, 0x65,
+	0x6e, 0x74, 0x73, 0x22, 0x40, 0x0a, 0x10, 0x54, 0x4c, 0x53, 0x41, 0x4c, 0x50, 0x4e, 0x43, 0x68,
+	0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x63,
+	0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f,
+	0x6e, 0x74, 0x65, 0x6e, 0x74, 0x32, 0xba, 0x05, 0x0a, 0x08, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x53,
+	0x72, 0x76, 0x12, 0x4f, 0x0a, 0x13, 0x41, 0x64, 0x64, 0x48, 0x54, 0x54, 0x50, 0x4f, 0x6e, 0x65,
+	0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x12, 0x1e, 0x2e, 0x63, 0x68, 0x61, 0x6c,
+	0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x48, 0x54, 0x54, 0x50, 0x4f, 0x6e, 0x65,
+	0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74,
+	0x79, 0x22, 0x00, 0x12, 0x47, 0x0a, 0x16, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x48, 0x54, 0x54,
+	0x50, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x12, 0x13, 0x2e,
+	0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x54, 0x6f, 0x6b,
+	0x65, 0x6e, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x4c, 0x0a, 0x13,
+	0x47, 0x65, 0x74, 0x48, 0x54, 0x54, 0x50, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65,
+	0x6e, 0x67, 0x65, 0x12, 0x13, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73,
+	0x72, 0x76, 0x2e, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x1a, 0x1e, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c,
+	0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x48, 0x54, 0x54, 0x50, 0x4f, 0x6e, 0x65, 0x43,
+	0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x22, 0x00, 0x12, 0x4d, 0x0a, 0x12, 0x41, 0x64,
+	0x64, 0x44, 0x4e, 0x53, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65,
+	0x12, 0x1d, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e,
+	0x44, 0x4e, 0x53, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x1a,
+	0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x45, 0x0a, 0x15, 0x44, 0x65, 0x6c,
+	0x65, 0x74, 0x65, 0x44, 0x4e, 0x53, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e,
+	0x67, 0x65, 0x12, 0x12, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72,
+	0x76, 0x2e, 0x48, 0x6f, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00,
+	0x12, 0x4a, 0x0a, 0x12, 0x47, 0x65, 0x74, 0x44, 0x4e, 0x53, 0x4f, 0x6e, 0x65, 0x43, 0x68, 0x61,
+	0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x12, 0x12, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65,
+	0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x48, 0x6f, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x63, 0x68, 0x61,
+	0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x44, 0x4e, 0x53, 0x4f, 0x6e, 0x65,
+	0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x73, 0x22, 0x00, 0x12, 0x4f, 0x0a, 0x13,
+	0x41, 0x64, 0x64, 0x54, 0x4c, 0x53, 0x41, 0x4c, 0x50, 0x4e, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65,
+	0x6e, 0x67, 0x65, 0x12, 0x1e, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73,
+	0x72, 0x76, 0x2e, 0x54, 0x4c, 0x53, 0x41, 0x4c, 0x50, 0x4e, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65,
+	0x6e, 0x67, 0x65, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x46, 0x0a,
+	0x16, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x4c, 0x53, 0x41, 0x4c, 0x50, 0x4e, 0x43, 0x68,
+	0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x12, 0x12, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74,
+	0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x48, 0x6f, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d,
+	0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x4b, 0x0a, 0x13, 0x47, 0x65, 0x74, 0x54, 0x4c, 0x53, 0x41,
+	0x4c, 0x50, 0x4e, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65, 0x12, 0x12, 0x2e, 0x63,
+	0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e, 0x48, 0x6f, 0x73, 0x74,
+	0x1a, 0x1e, 0x2e, 0x63, 0x68, 0x61, 0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2e,
+	0x54, 0x4c, 0x53, 0x41, 0x4c, 0x50, 0x4e, 0x43, 0x68, 0x61, 0x6c, 0x6c, 0x65, 0x6e, 0x67, 0x65,
+	0x22, 0x00, 0x42, 0x2b, 0x5a, 0x29, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
+	0x2f, 0x6c, 0x65, 0x74, 0x73, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x2f, 0x63, 0x68, 0x61,
+	0x6c, 0x6c, 0x74, 0x65, 0x73, 0x74, 0x73, 0x72, 0x76, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_challtestsrv_proto_rawDescOnce sync.Once
+	file_challtestsrv_proto_rawDescData = file_challtestsrv_proto_rawDesc
+)
+
+func file_challtestsrv_proto_rawDescGZIP() []byte {
+	file_challtestsrv_proto_rawDescOnce.Do(func() {
+		file_challtestsrv_proto_rawDescData = protoimpl.X.CompressGZIP(file_challtestsrv_proto_rawDescData)
+	})
+	return file_challtestsrv_proto_rawDescData
+}
+
+var file_challtestsrv_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_challtestsrv_proto_goTypes = []interface{}{
+	(*Token)(nil),            // 0: challtestsrv.Token
+	(*Host)(nil),             // 1: challtestsrv.Host
+	(*HTTPOneChallenge)(nil), // 2: challtestsrv.HTTPOneChallenge
+	(*DNSOneChallenge)(nil),  // 3: challtestsrv.DNSOneChallenge
+	(*DNSOneChallenges)(nil), // 4: challtestsrv.DNSOneChallenges
+	(*TLSALPNChallenge)(nil), // 5: challtestsrv.TLSALPNChallenge
+	(*emptypb.Empty)(nil),    // 6: google.protobuf.Empty
+}
+var file_challtestsrv_proto_depIdxs = []int32{
+	2, // 0: challtestsrv.ChallSrv.AddHTTPOneChallenge:input_type -> challtestsrv.HTTPOneChallenge
+	0, // 1: challtestsrv.ChallSrv.DeleteHTTPOneChallenge:input_type -> challtestsrv.Token
+	0, // 2: challtestsrv.ChallSrv.GetHTTPOneChallenge:input_type -> challtestsrv.Token
+	3, // 3: challtestsrv.ChallSrv.AddDNSOneChallenge:input_type -> challtestsrv.DNSOneChallenge
+	1, // 4: challtestsrv.ChallSrv.DeleteDNSOneChallenge:input_type -> challtestsrv.Host
+	1, // 5: challtestsrv.ChallSrv.GetDNSOneChallenge:input_type -> challtestsrv.Host
+	5, // 6: challtestsrv.ChallSrv.AddTLSALPNChallenge:input_type -> challtestsrv.TLSALPNChallenge
+	1, // 7: challtestsrv.ChallSrv.DeleteTLSALPNChallenge:input_type -> challtestsrv.Host
+	1, // 8: challtestsrv.ChallSrv.GetTLSALPNChallenge:input_type -> challtestsrv.Host
+	6, // 9: challtestsrv.ChallSrv.AddHTTPOneChallenge:output_type -> google.protobuf.Empty
+	6, // 10: challtestsrv.ChallSrv.DeleteHTTPOneChallenge:output_type -> google.protobuf.Empty
+	2, // 11: challtestsrv.ChallSrv.GetHTTPOneChallenge:output_type -> challtestsrv.HTTPOneChallenge
+	6, // 12: challtestsrv.ChallSrv.AddDNSOneChallenge:output_type -> google.protobuf.Empty
+	6, // 13: challtestsrv.ChallSrv.DeleteDNSOneChallenge:output_type -> google.protobuf.Empty
+	4, // 14: challtestsrv.ChallSrv.GetDNSOneChallenge:output_type -> challtestsrv.DNSOneChallenges
+	6, // 15: challtestsrv.ChallSrv.AddTLSALPNChallenge:output_type -> google.protobuf.Empty
+	6, // 16: challtestsrv.ChallSrv.DeleteTLSALPNChallenge:output_type -> google.protobuf.Empty
+	5, // 17: challtestsrv.ChallSrv.GetTLSALPNChallenge:output_type -> challtestsrv.TLSALPNChallenge
+	9, // [9:18] is the sub-list for method output_type
+	0, // [0:9] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_challtestsrv_proto_init() }
+func file_challtestsrv_proto_init() {
+	if File_challtestsrv_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_challtestsrv_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Token); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_challtestsrv_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Host); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_challtestsrv_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HTTPOneChallenge); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_challtestsrv_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DNSOneChallenge); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_challtestsrv_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DNSOneChallenges); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_challtestsrv_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TLSALPNChallenge); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_challtestsrv_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_challtestsrv_proto_goTypes,
+		DependencyIndexes: file_challtestsrv_proto_depIdxs,
+		MessageInfos:      file_challtestsrv_proto_msgTypes,
+	}.Build()
+	File_challtestsrv_proto = out.File
+	file_challtestsrv_proto_rawDesc = nil
+	file_challtestsrv_proto_goTypes = nil
+	file_challtestsrv_proto_depIdxs = nil
+}
@@ -0,0 +1,394 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.20.1
+// source: challtestsrv.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ChallSrvClient is the client API for ChallSrv service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChallSrvClient interface {
+	AddHTTPOneChallenge(ctx context.Context, in *HTTPOneChallenge, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteHTTPOneChallenge(ctx context.Context, in *Token, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetHTTPOneChallenge(ctx context.Context, in *Token, opts ...grpc.CallOption) (*HTTPOneChallenge, error)
+	AddDNSOneChallenge(ctx context.Context, in *DNSOneChallenge, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteDNSOneChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetDNSOneChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*DNSOneChallenges, error)
+	AddTLSALPNChallenge(ctx context.Context, in *TLSALPNChallenge, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteTLSALPNChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetTLSALPNChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*TLSALPNChallenge, error)
+}
+
+type challSrvClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChallSrvClient(cc grpc.ClientConnInterface) ChallSrvClient {
+	return &challSrvClient{cc}
+}
+
+func (c *challSrvClient) AddHTTPOneChallenge(ctx context.Context, in *HTTPOneChallenge, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/AddHTTPOneChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) DeleteHTTPOneChallenge(ctx context.Context, in *Token, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/DeleteHTTPOneChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) GetHTTPOneChallenge(ctx context.Context, in *Token, opts ...grpc.CallOption) (*HTTPOneChallenge, error) {
+	out := new(HTTPOneChallenge)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/GetHTTPOneChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) AddDNSOneChallenge(ctx context.Context, in *DNSOneChallenge, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/AddDNSOneChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) DeleteDNSOneChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/DeleteDNSOneChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) GetDNSOneChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*DNSOneChallenges, error) {
+	out := new(DNSOneChallenges)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/GetDNSOneChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) AddTLSALPNChallenge(ctx context.Context, in *TLSALPNChallenge, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/AddTLSALPNChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) DeleteTLSALPNChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/DeleteTLSALPNChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *challSrvClient) GetTLSALPNChallenge(ctx context.Context, in *Host, opts ...grpc.CallOption) (*TLSALPNChallenge, error) {
+	out := new(TLSALPNChallenge)
+	err := c.cc.Invoke(ctx, "/challtestsrv.ChallSrv/GetTLSALPNChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChallSrvServer is the server API for ChallSrv service.
+// All implementations must embed UnimplementedChallSrvServer
+// for forward compatibility
+type ChallSrvServer interface {
+	AddHTTPOneChallenge(context.Context, *HTTPOneChallenge) (*emptypb.Empty, error)
+	DeleteHTTPOneChallenge(context.Context, *Token) (*emptypb.Empty, error)
+	GetHTTPOneChallenge(context.Context, *Token) (*HTTPOneChallenge, error)
+	AddDNSOneChallenge(context.Context, *DNSOneChallenge) (*emptypb.Empty, error)
+	DeleteDNSOneChallenge(context.Context, *Host) (*emptypb.Empty, error)
+	GetDNSOneChallenge(context.Context, *Host) (*DNSOneChallenges, error)
+	AddTLSALPNChallenge(context.Context, *TLSALPNChallenge) (*emptypb.Empty, error)
+	DeleteTLSALPNChallenge(context.Context, *Host) (*emptypb.Empty, error)
+	GetTLSALPNChallenge(context.Context, *Host) (*TLSALPNChallenge, error)
+	mustEmbedUnimplementedChallSrvServer()
+}
+
+// UnimplementedChallSrvServer must be embedded to have forward compatible implementations.
+type UnimplementedChallSrvServer struct {
+}
+
+func (UnimplementedChallSrvServer) AddHTTPOneChallenge(context.Context, *HTTPOneChallenge) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddHTTPOneChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) DeleteHTTPOneChallenge(context.Context, *Token) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteHTTPOneChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) GetHTTPOneChallenge(context.Context, *Token) (*HTTPOneChallenge, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHTTPOneChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) AddDNSOneChallenge(context.Context, *DNSOneChallenge) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddDNSOneChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) DeleteDNSOneChallenge(context.Context, *Host) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteDNSOneChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) GetDNSOneChallenge(context.Context, *Host) (*DNSOneChallenges, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDNSOneChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) AddTLSALPNChallenge(context.Context, *TLSALPNChallenge) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddTLSALPNChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) DeleteTLSALPNChallenge(context.Context, *Host) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTLSALPNChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) GetTLSALPNChallenge(context.Context, *Host) (*TLSALPNChallenge, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTLSALPNChallenge not implemented")
+}
+func (UnimplementedChallSrvServer) mustEmbedUnimplementedChallSrvServer() {}
+
+// UnsafeChallSrvServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChallSrvServer will
+// result in compilation errors.
+type UnsafeChallSrvServer interface {
+	mustEmbedUnimplementedChallSrvServer()
+}
+
+func RegisterChallSrvServer(s grpc.ServiceRegistrar, srv ChallSrvServer) {
+	s.RegisterService(&ChallSrv_ServiceDesc, srv)
+}
+
+func _ChallSrv_AddHTTPOneChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HTTPOneChallenge)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).AddHTTPOneChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/AddHTTPOneChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).AddHTTPOneChallenge(ctx, req.(*HTTPOneChallenge))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_DeleteHTTPOneChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).DeleteHTTPOneChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/DeleteHTTPOneChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).DeleteHTTPOneChallenge(ctx, req.(*Token))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_GetHTTPOneChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).GetHTTPOneChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/GetHTTPOneChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).GetHTTPOneChallenge(ctx, req.(*Token))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_AddDNSOneChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DNSOneChallenge)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).AddDNSOneChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/AddDNSOneChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).AddDNSOneChallenge(ctx, req.(*DNSOneChallenge))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_DeleteDNSOneChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Host)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).DeleteDNSOneChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/DeleteDNSOneChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).DeleteDNSOneChallenge(ctx, req.(*Host))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_GetDNSOneChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Host)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).GetDNSOneChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/GetDNSOneChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).GetDNSOneChallenge(ctx, req.(*Host))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_AddTLSALPNChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TLSALPNChallenge)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).AddTLSALPNChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/AddTLSALPNChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).AddTLSALPNChallenge(ctx, req.(*TLSALPNChallenge))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_DeleteTLSALPNChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Host)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).DeleteTLSALPNChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/DeleteTLSALPNChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).DeleteTLSALPNChallenge(ctx, req.(*Host))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChallSrv_GetTLSALPNChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Host)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChallSrvServer).GetTLSALPNChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/challtestsrv.ChallSrv/GetTLSALPNChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChallSrvServer).GetTLSALPNChallenge(ctx, req.(*Host))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChallSrv_ServiceDesc is the grpc.ServiceDesc for ChallSrv service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChallSrv_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "challtestsrv.ChallSrv",
+	HandlerType: (*ChallSrvServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddHTTPOneChallenge",
+			Handler:    _ChallSrv_AddHTTPOneChallenge_Handler,
+		},
+		{
+			MethodName: "DeleteHTTPOneChallenge",
+			Handler:    _ChallSrv_DeleteHTTPOneChallenge_Handler,
+		},
+		{
+			MethodName: "GetHTTPOneChallenge",
+			Handler:    _ChallSrv_GetHTTPOneChallenge_Handler,
+		},
+		{
+			MethodName: "AddDNSOneChallenge",
+			Handler:    _ChallSrv_AddDNSOneChallenge_Handler,
+		},
+		{
+			MethodName: "DeleteDNSOneChallenge",
+			Handler:    _ChallSrv_DeleteDNSOneChallenge_Handler,
+		},
+		{
+			MethodName: "GetDNSOneChallenge",
+			Handler:    _ChallSrv_GetDNSOneChallenge_Handler,
+		},
+		{
+			MethodName: "AddTLSALPNChallenge",
+			Handler:    _ChallSrv_AddTLSALPNChallenge_Handler,
+		},
+		{
+			MethodName: "DeleteTLSALPNChallenge",
+			Handler:    _ChallSrv_DeleteTLSALPNChallenge_Handler,
+		},
+		{
+			MethodName: "GetTLSALPNChallenge",
+			Handler:    _ChallSrv_GetTLSALPNChallenge_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "challtestsrv.proto",
+}
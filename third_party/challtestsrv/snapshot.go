@@ -0,0 +1,56 @@
+package challtestsrv
+
+// Snapshot gives direct access to the HTTP-01, DNS-01 and TLS-ALPN-01
+// challenges added to a ChallSrv. It is passed to the function given to
+// WithChallenges and must not be used after that function returns. It is not
+// the format of the file written by SaveChallenges, see challengeState.
+type Snapshot struct {
+	// HTTPOne is a map of HTTP-01 token to key authorization.
+	HTTPOne map[string]string
+	// DNSOne is a map of DNS-01 host to TXT record values.
+	DNSOne map[string][]string
+	// TLSALPNOne is a map of TLS-ALPN-01 host to key authorization. Hosts are
+	// normalized like they are by AddTLSALPNChallenge when f returns.
+	TLSALPNOne map[string]string
+	// TLSALPNPerSource is a map of TLS-ALPN-01 host to a map of client IP
+	// address to the key authorization served to that client, as added with
+	// AddTLSALPNChallengePerSource. Hosts and addresses are normalized like
+	// they are by AddTLSALPNChallengePerSource when f returns.
+	TLSALPNPerSource map[string]map[string]string
+}
+
+// WithChallenges calls f with a Snapshot of the challenge server's challenges
+// while holding the challenge lock, so that a batch of reads and writes is
+// applied atomically with respect to other API calls and to the challenge
+// servers answering requests. Changes made to the Snapshot's maps, including
+// replacing them, take effect when f returns. f must not call other ChallSrv
+// methods or it will deadlock.
+func (s *ChallSrv) WithChallenges(f func(*Snapshot)) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	snapshot := &Snapshot{
+		HTTPOne:          s.httpOne,
+		DNSOne:           s.dnsOne,
+		TLSALPNOne:       s.tlsALPNOne,
+		TLSALPNPerSource: s.tlsALPNPerSource,
+	}
+	f(snapshot)
+
+	s.httpOne = snapshot.HTTPOne
+	if s.httpOne == nil {
+		s.httpOne = make(map[string]string)
+	}
+	s.dnsOne = snapshot.DNSOne
+	if s.dnsOne == nil {
+		s.dnsOne = make(map[string][]string)
+	}
+	s.tlsALPNOne = make(map[string]string, len(snapshot.TLSALPNOne))
+	for host, content := range snapshot.TLSALPNOne {
+		s.tlsALPNOne[tlsALPNHost(host)] = content
+	}
+	s.tlsALPNPerSource = make(map[string]map[string]string, len(snapshot.TLSALPNPerSource))
+	for host, bySourceIP := range snapshot.TLSALPNPerSource {
+		s.tlsALPNPerSource[tlsALPNHost(host)] = tlsALPNSources(bySourceIP)
+	}
+}
@@ -0,0 +1,188 @@
+package challtestsrv_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestWithChallenges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		f        func(*challtestsrv.Snapshot)
+		wantHTTP bool
+		wantDNS  bool
+		wantTLS  bool
+		after    func(*challtestsrv.ChallSrv)
+	}{
+		{
+			name: "add across challenge types",
+			f: func(s *challtestsrv.Snapshot) {
+				s.HTTPOne["token"] = "http"
+				s.DNSOne["_acme-challenge.example.com."] = []string{"dns"}
+				// TLS-ALPN-01 hosts are normalized when f returns.
+				s.TLSALPNOne["Example.COM."] = "tls"
+			},
+			wantHTTP: true,
+			wantDNS:  true,
+			wantTLS:  true,
+		},
+		{
+			name: "delete across challenge types",
+			f: func(s *challtestsrv.Snapshot) {
+				delete(s.HTTPOne, "token")
+				delete(s.DNSOne, "_acme-challenge.example.com.")
+				delete(s.TLSALPNOne, "example.com")
+			},
+		},
+		{
+			name: "replace maps with nil",
+			f: func(s *challtestsrv.Snapshot) {
+				s.HTTPOne = nil
+				s.DNSOne = nil
+				s.TLSALPNOne = nil
+			},
+			// Maps replaced with nil must be usable by later calls.
+			after: func(srv *challtestsrv.ChallSrv) {
+				srv.AddHTTPOneChallenge("token", "http")
+				srv.AddDNSOneChallenge("_acme-challenge.example.com.", "dns")
+				srv.AddTLSALPNChallenge("example.com", "tls")
+			},
+			wantHTTP: true,
+			wantDNS:  true,
+			wantTLS:  true,
+		},
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", "http")
+	srv.AddDNSOneChallenge("_acme-challenge.example.com.", "dns")
+	srv.AddTLSALPNChallenge("example.com", "tls")
+	// The cases run in order against the same server.
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.WithChallenges(tc.f)
+			if tc.after != nil {
+				tc.after(srv)
+			}
+
+			_, gotHTTP := srv.GetHTTPOneChallenge("token")
+			gotDNS := len(srv.GetDNSOneChallenge("_acme-challenge.example.com.")) > 0
+			_, gotTLS := srv.GetTLSALPNChallenge("example.com")
+			if gotHTTP != tc.wantHTTP || gotDNS != tc.wantDNS || gotTLS != tc.wantTLS {
+				t.Errorf("got HTTP-01 %t, DNS-01 %t, TLS-ALPN-01 %t challenges, want %t, %t, %t",
+					gotHTTP, gotDNS, gotTLS, tc.wantHTTP, tc.wantDNS, tc.wantTLS)
+			}
+		})
+	}
+}
+
+// TestWithChallengesConcurrent adds and deletes challenges of every type from
+// several goroutines, both in WithChallenges batches and with the individual
+// Add and Delete methods, while clients make HTTP-01 requests, DNS-01 queries
+// and TLS-ALPN-01 handshakes against the server. It is meant to be run with
+// -race.
+func TestWithChallengesConcurrent(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+
+	const writers = 4
+	const iterations = 50
+	host := func(w, i int) string { return fmt.Sprintf("w%d-%d.example.com", w, i%5) }
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	reader := func(f func(i int)) {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				f(i)
+			}
+		}()
+	}
+	reader(func(i int) {
+		resp, err := http.Get("http://" + srv.HTTPOneAddr() + "/.well-known/acme-challenge/" + host(i%writers, i))
+		if err == nil {
+			resp.Body.Close()
+		}
+	})
+	reader(func(i int) {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn("_acme-challenge."+host(i%writers, i)), dns.TypeTXT)
+		_, _ = dns.Exchange(m, srv.DNSOneAddr())
+	})
+	reader(func(i int) {
+		_, _ = handshakeTLSALPN(srv, host(i%writers, i))
+	})
+	reader(func(i int) {
+		dialer := &net.Dialer{Timeout: time.Second}
+		conn, err := tls.DialWithDialer(dialer, "tcp", srv.TLSALPNOneAddr(), &tls.Config{
+			ServerName:         host(i%writers, i),
+			NextProtos:         []string{challtestsrv.ACMETLS1Protocol},
+			InsecureSkipVerify: true,
+		})
+		if err == nil {
+			conn.Close()
+		}
+	})
+
+	var writersWG sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		writersWG.Add(1)
+		go func(w int) {
+			defer writersWG.Done()
+			for i := 0; i < iterations; i++ {
+				h := host(w, i)
+				if i%2 == 0 {
+					srv.WithChallenges(func(s *challtestsrv.Snapshot) {
+						s.HTTPOne[h] = "http"
+						s.DNSOne[dns.Fqdn("_acme-challenge."+h)] = []string{"dns"}
+						s.TLSALPNOne[h] = "tls"
+						delete(s.HTTPOne, host(w, i+1))
+					})
+				} else {
+					srv.AddHTTPOneChallenge(h, "http")
+					srv.AddDNSOneChallenge(dns.Fqdn("_acme-challenge."+h), "dns")
+					srv.AddTLSALPNChallenge(h, "tls")
+					srv.DeleteHTTPOneChallenge(host(w, i+1))
+					srv.DeleteDNSOneChallenge(dns.Fqdn("_acme-challenge." + host(w, i+1)))
+					srv.DeleteTLSALPNChallenge(host(w, i+1))
+				}
+			}
+			// Leave one challenge of each type behind to check afterwards.
+			srv.WithChallenges(func(s *challtestsrv.Snapshot) {
+				s.HTTPOne[fmt.Sprintf("final-%d", w)] = "http"
+				s.DNSOne[fmt.Sprintf("_acme-challenge.final-%d.example.com.", w)] = []string{"dns"}
+				s.TLSALPNOne[fmt.Sprintf("final-%d.example.com", w)] = "tls"
+			})
+		}(w)
+	}
+	writersWG.Wait()
+	close(stop)
+	readers.Wait()
+
+	for w := 0; w < writers; w++ {
+		if _, found := srv.GetHTTPOneChallenge(fmt.Sprintf("final-%d", w)); !found {
+			t.Errorf("HTTP-01 challenge of writer %d is missing", w)
+		}
+		if len(srv.GetDNSOneChallenge(fmt.Sprintf("_acme-challenge.final-%d.example.com.", w))) == 0 {
+			t.Errorf("DNS-01 challenge of writer %d is missing", w)
+		}
+		if _, err := handshakeTLSALPN(srv, fmt.Sprintf("final-%d.example.com", w)); err != nil {
+			t.Errorf("TLS-ALPN-01 handshake for writer %d failed: %s", w, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package challtestsrv
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ServerStatus is a snapshot of a ChallSrv's listeners, challenges and request
+// counters returned by Status. It is meant for debugging tests.
+type ServerStatus struct {
+	// Ready is true once every challenge server has bound its listeners.
+	Ready bool
+	// HTTPOneAddrs are the addresses bound by the HTTP-01 challenge servers.
+	HTTPOneAddrs []string
+	// HTTPSOneAddrs are the addresses bound by the HTTPS HTTP-01 challenge
+	// servers.
+	HTTPSOneAddrs []string
+	// DNSOneAddrs are the addresses bound by the DNS-01 challenge servers.
+	DNSOneAddrs []string
+	// DOHAddrs are the addresses bound by the DNS-over-HTTPS servers.
+	DOHAddrs []string
+	// TLSALPNOneAddrs are the addresses bound by the TLS-ALPN-01 challenge
+	// server.
+	TLSALPNOneAddrs []string
+	// GRPCAddrs are the addresses bound by the gRPC management servers.
+	GRPCAddrs []string
+	// HTTPOneChallenges is the number of HTTP-01 tokens with a challenge.
+	HTTPOneChallenges int
+	// DNSOneChallenges is the number of hosts with DNS-01 TXT records.
+	DNSOneChallenges int
+	// TLSALPNOneChallenges is the number of hosts with a TLS-ALPN-01
+	// challenge.
+	TLSALPNOneChallenges int
+	// HTTPOneRequests counts HTTP-01 requests by scheme.
+	HTTPOneRequests map[string]uint64
+	// DNSQueries counts DNS questions by query type.
+	DNSQueries map[string]uint64
+	// TLSALPNHandshakes counts TLS-ALPN-01 handshakes by outcome.
+	TLSALPNHandshakes map[string]uint64
+}
+
+// Status returns a ServerStatus describing the challenge server's bound
+// listeners, how many challenges of each type have been added and the request
+// counters also exported by MetricsHandler.
+func (s *ChallSrv) Status() ServerStatus {
+	status := ServerStatus{
+		Ready:             s.Ready(),
+		HTTPOneAddrs:      s.allBoundAddrs(httpOneServerKind),
+		HTTPSOneAddrs:     s.allBoundAddrs(httpsOneServerKind),
+		DNSOneAddrs:       s.allBoundAddrs(dnsOneServerKind),
+		DOHAddrs:          s.allBoundAddrs(dohServerKind),
+		TLSALPNOneAddrs:   s.allBoundAddrs(tlsALPNServerKind),
+		GRPCAddrs:         s.allBoundAddrs(grpcServerKind),
+		HTTPOneRequests:   counterValues(s.metrics.httpOneRequests),
+		DNSQueries:        counterValues(s.metrics.dnsQueries),
+		TLSALPNHandshakes: counterValues(s.metrics.tlsALPNHandshakes),
+	}
+
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	status.HTTPOneChallenges = len(s.httpOne)
+	status.DNSOneChallenges = len(s.dnsOne)
+	status.TLSALPNOneChallenges = len(s.tlsALPNOne)
+	return status
+}
+
+// counterValues returns the current value of each counter in vec, keyed by the
+// value of its only label.
+func counterValues(vec *prometheus.CounterVec) map[string]uint64 {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(metrics)
+		close(metrics)
+	}()
+	values := make(map[string]uint64)
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil || len(m.GetLabel()) != 1 {
+			continue
+		}
+		values[m.GetLabel()[0].GetValue()] = uint64(m.GetCounter().GetValue())
+	}
+	return values
+}
@@ -0,0 +1,55 @@
+package challtestsrv_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+func TestStatus(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddHTTPOneChallenge("token", "http")
+	srv.AddHTTPOneChallenge("other-token", "http")
+	srv.AddDNSOneChallenge("_acme-challenge.example.com.", "dns")
+	srv.AddTLSALPNChallenge("example.com", "tls")
+
+	getHTTPOne(t, srv, "token")
+	queryDNS(t, srv, "udp", "_acme-challenge.example.com", dns.TypeTXT)
+	queryDNS(t, srv, "udp", "example.com", dns.TypeA)
+	if _, err := handshakeTLSALPN(srv, "example.com"); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+
+	status := srv.Status()
+	if !status.Ready {
+		t.Error("Status().Ready = false for a running server")
+	}
+	if !reflect.DeepEqual(status.HTTPOneAddrs, []string{srv.HTTPOneAddr()}) {
+		t.Errorf("HTTPOneAddrs = %q, want [%q]", status.HTTPOneAddrs, srv.HTTPOneAddr())
+	}
+	if !reflect.DeepEqual(status.DNSOneAddrs, []string{srv.DNSOneAddr()}) {
+		t.Errorf("DNSOneAddrs = %q, want [%q]", status.DNSOneAddrs, srv.DNSOneAddr())
+	}
+	if !reflect.DeepEqual(status.TLSALPNOneAddrs, []string{srv.TLSALPNOneAddr()}) {
+		t.Errorf("TLSALPNOneAddrs = %q, want [%q]", status.TLSALPNOneAddrs, srv.TLSALPNOneAddr())
+	}
+	if len(status.HTTPSOneAddrs) != 0 || len(status.DOHAddrs) != 0 || len(status.GRPCAddrs) != 0 {
+		t.Errorf("Status has addresses for servers that weren't configured: %+v", status)
+	}
+	if status.HTTPOneChallenges != 2 || status.DNSOneChallenges != 1 || status.TLSALPNOneChallenges != 1 {
+		t.Errorf("Status has %d HTTP-01, %d DNS-01 and %d TLS-ALPN-01 challenges, want 2, 1 and 1",
+			status.HTTPOneChallenges, status.DNSOneChallenges, status.TLSALPNOneChallenges)
+	}
+	if want := map[string]uint64{"http": 1}; !reflect.DeepEqual(status.HTTPOneRequests, want) {
+		t.Errorf("HTTPOneRequests = %v, want %v", status.HTTPOneRequests, want)
+	}
+	if want := map[string]uint64{"TXT": 1, "A": 1}; !reflect.DeepEqual(status.DNSQueries, want) {
+		t.Errorf("DNSQueries = %v, want %v", status.DNSQueries, want)
+	}
+	if want := map[string]uint64{"served-challenge": 1}; !reflect.DeepEqual(status.TLSALPNHandshakes, want) {
+		t.Errorf("TLSALPNHandshakes = %v, want %v", status.TLSALPNHandshakes, want)
+	}
+}
@@ -0,0 +1,1025 @@
+package challtestsrv
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ALPN protocol ID for TLS-ALPN-01 challenge
+// https://tools.ietf.org/html/draft-ietf-acme-tls-alpn-01#section-5.2
+const ACMETLS1Protocol = "acme-tls/1"
+
+// IDPeAcmeIdentifier is the identifier defined in
+// https://tools.ietf.org/html/draft-ietf-acme-tls-alpn-04#section-5.1
+// id-pe OID + 31 (acmeIdentifier)
+var IDPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// TLSALPNAcmeIdentifierValue returns the value of the acmeIdentifier extension
+// a TLS-ALPN-01 challenge certificate carries for the given key authorization:
+// the DER encoding of an OCTET STRING containing the SHA-256 digest of the key
+// authorization.
+func TLSALPNAcmeIdentifierValue(keyAuth string) ([]byte, error) {
+	return acmeIdentifierValue(sha256.Sum256([]byte(keyAuth)))
+}
+
+// acmeIdentifierValue returns the acmeIdentifier extension value for the given
+// key authorization digest.
+func acmeIdentifierValue(digest [sha256.Size]byte) ([]byte, error) {
+	return asn1.Marshal(digest[:])
+}
+
+// ValidateTLSALPNCert checks that cert is a valid TLS-ALPN-01 challenge
+// certificate for the given host and key authorization, as described in RFC
+// 8737 and, for IP address hosts, RFC 8738. The certificate must have exactly
+// one SAN, equal to the host, and exactly one acmeIdentifier extension, marked
+// critical, whose value is the DER encoding of an OCTET STRING containing the
+// SHA-256 digest of keyAuth. No extension may appear more than once. It returns
+// nil if the certificate is valid and an error describing the first problem
+// found otherwise.
+func ValidateTLSALPNCert(cert *x509.Certificate, host, keyAuth string) error {
+	host = tlsALPNHost(host)
+	if len(cert.EmailAddresses) != 0 || len(cert.URIs) != 0 {
+		return errors.New("certificate has email address or URI SANs")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if len(cert.DNSNames) != 0 || len(cert.IPAddresses) != 1 {
+			return fmt.Errorf("certificate must have exactly one SAN, got %d dNSNames and %d iPAddresses",
+				len(cert.DNSNames), len(cert.IPAddresses))
+		}
+		if !cert.IPAddresses[0].Equal(ip) {
+			return fmt.Errorf("iPAddress SAN %s does not match %s", cert.IPAddresses[0], ip)
+		}
+	} else {
+		if len(cert.DNSNames) != 1 || len(cert.IPAddresses) != 0 {
+			return fmt.Errorf("certificate must have exactly one SAN, got %d dNSNames and %d iPAddresses",
+				len(cert.DNSNames), len(cert.IPAddresses))
+		}
+		if !strings.EqualFold(cert.DNSNames[0], host) {
+			return fmt.Errorf("dNSName SAN %q does not match %q", cert.DNSNames[0], host)
+		}
+	}
+
+	expectedValue, err := TLSALPNAcmeIdentifierValue(keyAuth)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var acmeExtension *pkix.Extension
+	for i, ext := range cert.Extensions {
+		if seen[ext.Id.String()] {
+			return fmt.Errorf("extension %s appears more than once", ext.Id)
+		}
+		seen[ext.Id.String()] = true
+		if ext.Id.Equal(IDPeAcmeIdentifier) {
+			acmeExtension = &cert.Extensions[i]
+		}
+	}
+	if acmeExtension == nil {
+		return errors.New("certificate has no acmeIdentifier extension")
+	}
+	if !acmeExtension.Critical {
+		return errors.New("acmeIdentifier extension is not critical")
+	}
+	if !bytes.Equal(acmeExtension.Value, expectedValue) {
+		return errors.New("acmeIdentifier extension value does not match the key authorization")
+	}
+	return nil
+}
+
+var (
+	// ErrUnknownSNI is wrapped by the error returned from the
+	// ServeChallengeCertFunc function for acme-tls/1 handshakes whose
+	// ServerName has no TLS-ALPN-01 challenge.
+	ErrUnknownSNI = errors.New("unknown ClientHelloInfo.ServerName")
+	// ErrExtensionMarshal is wrapped by the error returned from the
+	// ServeChallengeCertFunc function when the acmeIdentifier extension value
+	// can't be encoded.
+	ErrExtensionMarshal = errors.New("failed marshalling hash OCTET STRING")
+)
+
+// maxTLSALPNRequests is the number of TLS-ALPN-01 handshakes remembered for
+// TLSALPNRequests.
+const maxTLSALPNRequests = 100
+
+// TLSALPNRequest describes a TLS-ALPN-01 handshake observed by
+// ServeChallengeCertFunc.
+type TLSALPNRequest struct {
+	// ServerName from the TLS Client Hello.
+	ServerName string
+	// SupportedProtos from the TLS Client Hello.
+	SupportedProtos []string
+	// ChallengeFound is true if a TLS-ALPN-01 challenge was registered for the
+	// ServerName when the handshake was processed.
+	ChallengeFound bool
+}
+
+// TLSALPNKeyType indicates which type of key is used to sign TLS-ALPN-01
+// challenge certificates.
+type TLSALPNKeyType int
+
+const (
+	// ECDSA P-256 keys
+	TLSALPNKeyECDSA TLSALPNKeyType = iota
+	// RSA 2048 bit keys
+	TLSALPNKeyRSA2048
+	// RSA 3072 bit keys
+	TLSALPNKeyRSA3072
+)
+
+// newTLSALPNKey generates a new private key of the given type for signing
+// TLS-ALPN-01 challenge certificates. ECDSA keys are generated on the given
+// curve.
+func newTLSALPNKey(typ TLSALPNKeyType, curve elliptic.Curve) (crypto.Signer, error) {
+	switch typ {
+	case TLSALPNKeyECDSA:
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case TLSALPNKeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case TLSALPNKeyRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return nil, fmt.Errorf("unknown TLSALPNKeyType: %d", typ)
+	}
+}
+
+// tlsALPNHost returns the key used to store TLS-ALPN-01 challenge data for the
+// given host. DNS names are case insensitive so the host is lowercased and any
+// trailing `.` is removed. IP address literals and the reverse DNS names RFC
+// 8738 uses as the SNI value for IP address identifiers are both converted to
+// the IP address in string form, so a challenge added for an IP address matches
+// handshakes for its reverse name.
+func tlsALPNHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	if ip := reverseNameIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// reverseNameIP parses a lowercase in-addr.arpa or ip6.arpa reverse DNS name
+// without a trailing `.` into the IP address it represents. If the name is not
+// a valid reverse DNS name nil is returned.
+func reverseNameIP(name string) net.IP {
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		nibbles := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(nibbles) != 2*net.IPv6len {
+			return nil
+		}
+		var hexIP strings.Builder
+		for i := len(nibbles) - 1; i >= 0; i-- {
+			if len(nibbles[i]) != 1 {
+				return nil
+			}
+			hexIP.WriteString(nibbles[i])
+		}
+		raw, err := hex.DecodeString(hexIP.String())
+		if err != nil {
+			return nil
+		}
+		return net.IP(raw)
+	}
+	return nil
+}
+
+// AddTLSALPNChallenge adds a new TLS-ALPN-01 key authorization for the given
+// host. The host may be a DNS name or an IP address. A DNS name whose first
+// label is "*", e.g. "*.example.com", also answers for any name one label
+// below it, like "foo.example.com", that has no challenge of its own.
+func (s *ChallSrv) AddTLSALPNChallenge(host, content string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	s.tlsALPNOne[host] = content
+	delete(s.tlsALPNMocks.badHash, host)
+}
+
+// AddTLSALPNChallenges adds the TLS-ALPN-01 key authorizations in the given map
+// of host to key authorization, like calling AddTLSALPNChallenge for each but
+// taking the challenge lock only once. This is cheaper when adding many
+// challenges while handshakes are being answered.
+func (s *ChallSrv) AddTLSALPNChallenges(challenges map[string]string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	for host, content := range challenges {
+		host = tlsALPNHost(host)
+		s.tlsALPNOne[host] = content
+		delete(s.tlsALPNMocks.badHash, host)
+	}
+}
+
+// UpdateTLSALPNChallenge atomically replaces the TLS-ALPN-01 key authorization
+// for the given host with newContent and returns the previous key
+// authorization along with true, or an empty string and false if there was no
+// challenge for the host (in which case one is added). Unlike
+// AddTLSALPNChallenge other settings for the host, such as a bad hash, are
+// kept. This is useful for simulating a client that regenerated its challenge
+// between validation attempts.
+func (s *ChallSrv) UpdateTLSALPNChallenge(host, newContent string) (string, bool) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	old, existed := s.tlsALPNOne[host]
+	s.tlsALPNOne[host] = newContent
+	return old, existed
+}
+
+// AddTLSALPNChallengeWithBadHash adds a new TLS-ALPN-01 key authorization for
+// the given host like AddTLSALPNChallenge, except that the challenge
+// certificates issued for the host will embed an incorrect SHA-256 digest of
+// the key authorization in the acmeIdentifier extension. This is useful for
+// testing that validators check the digest.
+func (s *ChallSrv) AddTLSALPNChallengeWithBadHash(host, content string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	s.tlsALPNOne[host] = content
+	s.tlsALPNMocks.badHash[host] = true
+}
+
+// DeleteTLSALPNChallenge deletes the key authorization for a given host
+func (s *ChallSrv) DeleteTLSALPNChallenge(host string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	host = tlsALPNHost(host)
+	delete(s.tlsALPNOne, host)
+	delete(s.tlsALPNPerSource, host)
+	delete(s.tlsALPNMocks.badHash, host)
+}
+
+// DeleteAllTLSALPNChallenges deletes the key authorizations for all hosts.
+// Handshakes that are in progress will fail as if the host had never been
+// added.
+func (s *ChallSrv) DeleteAllTLSALPNChallenges() {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.deleteAllTLSALPNChallenges()
+}
+
+// deleteAllTLSALPNChallenges deletes the key authorizations for all hosts. The
+// caller must hold the s.challMu write lock.
+func (s *ChallSrv) deleteAllTLSALPNChallenges() {
+	s.tlsALPNOne = make(map[string]string)
+	s.tlsALPNPerSource = make(map[string]map[string]string)
+	s.tlsALPNMocks.badHash = make(map[string]bool)
+}
+
+// GetTLSALPNChallenge checks the s.tlsALPNOne map for the given host.
+// If it is present it returns the key authorization and true, if not
+// it returns an empty string and false. The host may be a DNS name, an IP
+// address, or the reverse DNS name of an IP address. A DNS name without
+// a challenge of its own matches a challenge added for the wildcard name
+// covering it, so exact matches always take precedence.
+func (s *ChallSrv) GetTLSALPNChallenge(host string) (string, bool) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	if content, present := s.tlsALPNOne[host]; present {
+		return content, true
+	}
+	if wildcard := tlsALPNWildcard(host); wildcard != "" {
+		content, present := s.tlsALPNOne[wildcard]
+		return content, present
+	}
+	return "", false
+}
+
+// tlsALPNWildcard returns the wildcard name covering the given normalized host
+// by replacing its first label with "*", or an empty string for IP addresses
+// and names with a single label.
+func tlsALPNWildcard(host string) string {
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	_, parent, found := strings.Cut(host, ".")
+	if !found || parent == "" {
+		return ""
+	}
+	return "*." + parent
+}
+
+// AddTLSALPNChallengePerSource adds TLS-ALPN-01 key authorizations for the
+// given host that depend on the IP address of the connecting client.
+// bySourceIP maps client IP addresses to the key authorization served to them.
+// Clients whose address isn't in the map are answered using the host's
+// challenge added with AddTLSALPNChallenge, if any. This is useful for
+// simulating split-horizon targets when testing multi-perspective validation.
+// Calling it again replaces the previous per-source key authorizations.
+func (s *ChallSrv) AddTLSALPNChallengePerSource(host string, bySourceIP map[string]string) {
+	defer s.saveChallengeState()
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.tlsALPNPerSource[tlsALPNHost(host)] = tlsALPNSources(bySourceIP)
+}
+
+// tlsALPNSources returns a copy of the given map of client IP address to key
+// authorization with the addresses in their canonical form, so that they match
+// the address of a connecting client however they were written.
+func tlsALPNSources(bySourceIP map[string]string) map[string]string {
+	bySource := make(map[string]string, len(bySourceIP))
+	for source, content := range bySourceIP {
+		if ip := net.ParseIP(source); ip != nil {
+			source = ip.String()
+		}
+		bySource[source] = content
+	}
+	return bySource
+}
+
+// getTLSALPNChallengeFor is like GetTLSALPNChallenge except that key
+// authorizations added with AddTLSALPNChallengePerSource for the given
+// client address take precedence.
+func (s *ChallSrv) getTLSALPNChallengeFor(host string, remote net.Addr) (string, bool) {
+	if remote != nil {
+		source := remote.String()
+		if h, _, err := net.SplitHostPort(source); err == nil {
+			source = h
+		}
+		if ip := net.ParseIP(source); ip != nil {
+			source = ip.String()
+		}
+		s.challMu.RLock()
+		content, present := s.tlsALPNPerSource[tlsALPNHost(host)][source]
+		s.challMu.RUnlock()
+		if present {
+			return content, true
+		}
+	}
+	return s.GetTLSALPNChallenge(host)
+}
+
+// ListTLSALPNChallenges returns a copy of all of the TLS-ALPN-01 challenges
+// currently added, as a map of host to key authorization.
+func (s *ChallSrv) ListTLSALPNChallenges() map[string]string {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	challenges := make(map[string]string, len(s.tlsALPNOne))
+	for host, content := range s.tlsALPNOne {
+		challenges[host] = content
+	}
+	return challenges
+}
+
+// tlsALPNBadHash returns true if the TLS-ALPN-01 challenge for the given host
+// was added with AddTLSALPNChallengeWithBadHash.
+func (s *ChallSrv) tlsALPNBadHash(host string) bool {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	host = tlsALPNHost(host)
+	return s.tlsALPNMocks.badHash[host]
+}
+
+// addTLSALPNRequest records a TLS-ALPN-01 handshake in the s.tlsALPNRequests
+// ring buffer, discarding the oldest record if the buffer is full.
+func (s *ChallSrv) addTLSALPNRequest(hello *tls.ClientHelloInfo, found bool) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	if len(s.tlsALPNRequests) >= maxTLSALPNRequests {
+		s.tlsALPNRequests = s.tlsALPNRequests[1:]
+	}
+	s.tlsALPNRequests = append(s.tlsALPNRequests, TLSALPNRequest{
+		ServerName:      hello.ServerName,
+		SupportedProtos: hello.SupportedProtos,
+		ChallengeFound:  found,
+	})
+}
+
+// TLSALPNRequests returns the most recent TLS-ALPN-01 handshakes observed by the
+// server, oldest first.
+func (s *ChallSrv) TLSALPNRequests() []TLSALPNRequest {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	requests := make([]TLSALPNRequest, len(s.tlsALPNRequests))
+	copy(requests, s.tlsALPNRequests)
+	return requests
+}
+
+// TLSALPNPublicKey returns the public key of the key used to sign TLS-ALPN-01
+// challenge certificates. Since challenge certificates are self-signed this can
+// be used to verify their signatures. If no TLS-ALPN-01 server was configured
+// nil is returned.
+func (s *ChallSrv) TLSALPNPublicKey() crypto.PublicKey {
+	if s.tlsALPNKey == nil {
+		return nil
+	}
+	return s.tlsALPNKey.Public()
+}
+
+// countTLSALPNRequest increments the number of TLS-ALPN-01 challenge lookups
+// made for the given host.
+func (s *ChallSrv) countTLSALPNRequest(host string) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.tlsALPNRequestCounts[tlsALPNHost(host)]++
+}
+
+// TLSALPNRequestCount returns the number of TLS-ALPN-01 handshakes for the given
+// host that resulted in a challenge lookup, whether or not a challenge was
+// found.
+func (s *ChallSrv) TLSALPNRequestCount(host string) int {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	return s.tlsALPNRequestCounts[tlsALPNHost(host)]
+}
+
+// setLastTLSALPNCert records the DER of the challenge certificate just
+// generated for the given host.
+func (s *ChallSrv) setLastTLSALPNCert(host string, der []byte) {
+	s.challMu.Lock()
+	defer s.challMu.Unlock()
+	s.tlsALPNLastCerts[host] = der
+}
+
+// LastTLSALPNCert returns the DER of the most recent TLS-ALPN-01 challenge
+// certificate generated for the given host and true, or nil and false if none
+// has been generated. Override certificates set with SetTLSALPNOverrideCert
+// aren't included. This lets tests inspect the exact certificate served
+// without parsing it out of a TLS handshake.
+func (s *ChallSrv) LastTLSALPNCert(host string) ([]byte, bool) {
+	s.challMu.RLock()
+	defer s.challMu.RUnlock()
+	der, found := s.tlsALPNLastCerts[tlsALPNHost(host)]
+	return der, found
+}
+
+// tlsALPNOutcome describes how the TLS-ALPN-01 challenge server answered
+// a handshake.
+type tlsALPNOutcome string
+
+const (
+	// A challenge certificate was served
+	tlsALPNServedChallenge tlsALPNOutcome = "served-challenge"
+	// A certificate set with SetTLSALPNOverrideCert was served
+	tlsALPNServedOverride tlsALPNOutcome = "served-override"
+	// The fallback certificate was served because acme-tls/1 wasn't negotiated
+	tlsALPNServedFallback tlsALPNOutcome = "served-fallback"
+	// No challenge was found for the ServerName
+	tlsALPNUnknownSNI tlsALPNOutcome = "unknown-sni"
+	// A challenge was found but no certificate could be served
+	tlsALPNError tlsALPNOutcome = "error"
+	// The handshake was aborted with an alert set with SetTLSALPNAlert
+	tlsALPNSentAlert tlsALPNOutcome = "sent-alert"
+	// The handshake was failed at random because of SetChaosFailureRate
+	tlsALPNChaosFailure tlsALPNOutcome = "chaos-failure"
+)
+
+// logTLSALPNHandshake writes a line describing how a TLS-ALPN-01 handshake was
+// answered to the TLSALPNLog configured for the server, if any.
+func (s *ChallSrv) logTLSALPNHandshake(hello *tls.ClientHelloInfo, outcome tlsALPNOutcome, err error) {
+	if s.tlsALPNLog == nil {
+		return
+	}
+	challengeFound := outcome == tlsALPNServedChallenge || outcome == tlsALPNError
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
+	s.tlsALPNLog.Printf("TLS-ALPN-01 handshake sni=%q alpn=%q challengeFound=%t action=%s err=%q",
+		hello.ServerName, hello.SupportedProtos, challengeFound, outcome, errMsg)
+}
+
+// ServeChallengeCertFunc returns a tls.Config GetCertificate function that
+// answers handshakes negotiating acme-tls/1 with a TLS-ALPN-01 challenge
+// certificate signed by k. Its errors can be checked with errors.Is for
+// ErrUnknownSNI and ErrExtensionMarshal.
+func (s *ChallSrv) ServeChallengeCertFunc(k crypto.Signer) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, outcome, err := s.serveChallengeCert(hello, k)
+		s.metrics.tlsALPNHandshakes.WithLabelValues(string(outcome)).Inc()
+		s.logTLSALPNHandshake(hello, outcome, err)
+		s.notifyChallenge(ChallengeEvent{
+			Type:       TLSALPNRequestEventType,
+			Identifier: hello.ServerName,
+			Outcome:    string(outcome),
+		}, outcome == tlsALPNServedChallenge)
+		return cert, err
+	}
+}
+
+// noMutualProtocol is the only ALPN protocol offered by the config used to
+// abort handshakes with a no_application_protocol alert. No client offers it, so
+// negotiation always fails.
+const noMutualProtocol = "challtestsrv-no-mutual-protocol"
+
+// tlsALPNAlertConfigs are the tls.Configs returned from GetConfigForClient to
+// make the TLS stack abort a handshake with each TLSALPNAlert.
+var tlsALPNAlertConfigs = map[TLSALPNAlert]*tls.Config{
+	// A config without any certificates makes the handshake fail with
+	// unrecognized_name when a certificate is needed.
+	TLSALPNAlertUnrecognizedName:      {},
+	TLSALPNAlertNoApplicationProtocol: {NextProtos: []string{noMutualProtocol}},
+}
+
+// alertConfigForClient returns the config that makes the TLS stack abort the
+// handshake with the alert set with SetTLSALPNAlert for the hello's ServerName,
+// or nil if the handshake should be completed normally because no alert has
+// been set or the alert doesn't apply to the hello.
+func (s *ChallSrv) alertConfigForClient(hello *tls.ClientHelloInfo) *tls.Config {
+	alert := s.GetTLSALPNAlert(hello.ServerName)
+	if alert == TLSALPNAlertNone {
+		return nil
+	}
+	if alert == TLSALPNAlertNoApplicationProtocol && len(hello.SupportedProtos) == 0 {
+		// ALPN negotiation only fails if the client offers protocols. The
+		// alert config has no certificates, so using it here would fail the
+		// handshake with a different alert instead.
+		return nil
+	}
+	s.AddRequestEvent(TLSALPNRequestEvent{
+		ServerName:      hello.ServerName,
+		SupportedProtos: hello.SupportedProtos,
+	})
+	s.metrics.tlsALPNHandshakes.WithLabelValues(string(tlsALPNSentAlert)).Inc()
+	s.logTLSALPNHandshake(hello, tlsALPNSentAlert, nil)
+	s.notifyChallenge(ChallengeEvent{
+		Type:       TLSALPNRequestEventType,
+		Identifier: hello.ServerName,
+		Outcome:    string(tlsALPNSentAlert),
+	}, false)
+	return tlsALPNAlertConfigs[alert]
+}
+
+// isChallengeHello returns true if the given ClientHello offers only the
+// TLS-ALPN-01 protocol the server was configured with, normally acme-tls/1.
+// If the server was configured with a false TLSALPNStrictProtocol offering it
+// among other protocols is enough.
+func (s *ChallSrv) isChallengeHello(hello *tls.ClientHelloInfo) bool {
+	if s.tlsALPNStrictProtocol {
+		return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == s.tlsALPNProtocol
+	}
+	for _, proto := range hello.SupportedProtos {
+		if proto == s.tlsALPNProtocol {
+			return true
+		}
+	}
+	return false
+}
+
+// serveChallengeCert returns the certificate to present for the given
+// ClientHello and describes how the handshake was answered.
+func (s *ChallSrv) serveChallengeCert(hello *tls.ClientHelloInfo, k crypto.Signer) (*tls.Certificate, tlsALPNOutcome, error) {
+	s.AddRequestEvent(TLSALPNRequestEvent{
+		ServerName:      hello.ServerName,
+		SupportedProtos: hello.SupportedProtos,
+	})
+	// Handshakes that don't negotiate only the acme-tls/1 protocol are
+	// answered like a regular HTTPS server using the certificate for the SNI
+	// value, if one was set, or else the fallback certificate.
+	if !s.isChallengeHello(hello) {
+		s.addTLSALPNRequest(hello, false)
+		if cert := s.GetTLSALPNDefaultCertForSNI(hello.ServerName); cert != nil {
+			return cert, tlsALPNServedFallback, nil
+		}
+		return s.GetTLSALPNFallbackCert(), tlsALPNServedFallback, nil
+	}
+
+	// IP address identifiers use a reverse DNS name as the SNI value.
+	// Normalize it so the challenge data for the IP address is found.
+	host := tlsALPNHost(hello.ServerName)
+	var remote net.Addr
+	if hello.Conn != nil {
+		remote = hello.Conn.RemoteAddr()
+	}
+	ka, found := s.getTLSALPNChallengeFor(host, remote)
+	s.countTLSALPNRequest(host)
+	s.addTLSALPNRequest(hello, found)
+	if s.chaosFailure() {
+		return nil, tlsALPNChaosFailure, fmt.Errorf("injected transient handshake failure for %s", host)
+	}
+	if cert := s.GetTLSALPNOverrideCert(host); cert != nil {
+		return cert, tlsALPNServedOverride, nil
+	}
+	if der := s.GetTLSALPNMalformedDER(host); der != nil {
+		return &tls.Certificate{
+			Certificate: [][]byte{der},
+			PrivateKey:  k,
+		}, tlsALPNServedOverride, nil
+	}
+	if !found {
+		return nil, tlsALPNUnknownSNI, fmt.Errorf("%w: %s", ErrUnknownSNI, hello.ServerName)
+	}
+	if delay := s.GetTLSALPNDelay(host); delay > 0 {
+		if !sleepContext(hello.Context(), delay) {
+			return nil, tlsALPNError, fmt.Errorf("handshake aborted during delay: %s", hello.Context().Err())
+		}
+	}
+	if err := s.GetTLSALPNFailure(host); err != nil {
+		return nil, tlsALPNError, err
+	}
+	if s.tlsALPNFlakyFailure(host) {
+		return nil, tlsALPNError, fmt.Errorf("flaky handshake failure for %s", host)
+	}
+
+	cert, err := makeTLSALPNCert(host, ka, k, s.tlsALPNCertOptions(host))
+	if err != nil {
+		return nil, tlsALPNError, err
+	}
+	s.setLastTLSALPNCert(host, cert.Certificate[0])
+	return cert, tlsALPNServedChallenge, nil
+}
+
+// tlsALPNCertOptions holds the settings altering a TLS-ALPN-01 challenge
+// certificate built by makeTLSALPNCert. The zero value builds a certificate as
+// described in RFC 8737.
+type tlsALPNCertOptions struct {
+	badHash            bool
+	rawHash            bool
+	omitExtension      bool
+	duplicateExtension bool
+	badSignature       bool
+	isCA               bool
+	// nonCritical marks the acmeIdentifier extension as not critical.
+	nonCritical bool
+	// extensionOID replaces IDPeAcmeIdentifier if not nil.
+	extensionOID asn1.ObjectIdentifier
+	// serial is used instead of a random serial if not nil.
+	serial *big.Int
+	// validity is used instead of a window around the current time if not nil.
+	validity *validityWindow
+	// san is used as the SAN instead of the host if not empty.
+	san       string
+	extraSANs []string
+	// issuerCert and issuerKey sign the certificate instead of it being
+	// self-signed if not nil.
+	issuerCert *x509.Certificate
+	issuerKey  crypto.Signer
+	// intermediate is appended to the certificate chain if not nil.
+	intermediate []byte
+}
+
+// tlsALPNCertOptions returns the options for challenge certificates issued for
+// the given normalized host, as set with the SetTLSALPN* mocks.
+func (s *ChallSrv) tlsALPNCertOptions(host string) tlsALPNCertOptions {
+	opts := tlsALPNCertOptions{
+		badHash:            s.tlsALPNBadHash(host),
+		rawHash:            s.GetTLSALPNRawHash(host),
+		omitExtension:      s.GetTLSALPNOmitExtension(host),
+		duplicateExtension: s.GetTLSALPNDuplicateExtension(host),
+		badSignature:       s.GetTLSALPNBadSignature(host),
+		isCA:               s.GetTLSALPNIsCA(host),
+		nonCritical:        !s.GetTLSALPNExtensionCritical(host),
+		extensionOID:       s.GetTLSALPNExtensionOID(host),
+		serial:             s.GetTLSALPNSerial(host),
+		san:                s.GetTLSALPNWrongSAN(host),
+		extraSANs:          s.GetTLSALPNExtraSANs(host),
+		intermediate:       s.GetTLSALPNIntermediate(host),
+	}
+	if notBefore, notAfter, found := s.GetTLSALPNValidity(host); found {
+		opts.validity = &validityWindow{notBefore: notBefore, notAfter: notAfter}
+	}
+	opts.issuerCert, opts.issuerKey = s.GetTLSALPNExternalIssuer(host)
+	return opts
+}
+
+// MakeTLSALPNCert builds a TLS-ALPN-01 challenge certificate for the given host
+// and key authorization with the given key, as the TLS-ALPN-01 challenge server
+// does for a challenge without any SetTLSALPN* mocks. The host may be a DNS
+// name, an IP address, or the reverse DNS name of an IP address. This is useful
+// for feeding a known-good challenge certificate to validation code without
+// performing a handshake.
+func MakeTLSALPNCert(host, keyAuth string, key crypto.Signer) (*tls.Certificate, error) {
+	return makeTLSALPNCert(tlsALPNHost(host), keyAuth, key, tlsALPNCertOptions{})
+}
+
+// makeTLSALPNCert builds a challenge certificate for the given normalized host
+// and key authorization, altered by opts, whose public key is k's.
+func makeTLSALPNCert(host, ka string, k crypto.Signer, opts tlsALPNCertOptions) (*tls.Certificate, error) {
+	kaHash := sha256.Sum256([]byte(ka))
+	if opts.badHash {
+		// Flip the bits of the first byte so the digest no longer matches the
+		// key authorization.
+		kaHash[0] ^= 0xFF
+	}
+	extValue, err := acmeIdentifierValue(kaHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrExtensionMarshal, err)
+	}
+	if opts.rawHash {
+		extValue = kaHash[:]
+	}
+	serial := opts.serial
+	if serial == nil {
+		serial, err = rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+		if err != nil {
+			return nil, fmt.Errorf("failed generating challenge certificate serial: %s", err)
+		}
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(24 * time.Hour)
+	if opts.validity != nil {
+		notBefore, notAfter = opts.validity.notBefore, opts.validity.notAfter
+	}
+	certTmpl := x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	if opts.isCA {
+		certTmpl.BasicConstraintsValid = true
+		certTmpl.IsCA = true
+	}
+	san := host
+	if opts.san != "" {
+		san = opts.san
+	}
+	if ip := net.ParseIP(san); ip != nil {
+		certTmpl.IPAddresses = []net.IP{ip}
+		certTmpl.DNSNames = opts.extraSANs
+	} else {
+		certTmpl.DNSNames = append([]string{san}, opts.extraSANs...)
+	}
+	if !opts.omitExtension {
+		oid := opts.extensionOID
+		if oid == nil {
+			oid = IDPeAcmeIdentifier
+		}
+		acmeExtension := pkix.Extension{
+			Id:       oid,
+			Critical: !opts.nonCritical,
+			Value:    extValue,
+		}
+		certTmpl.ExtraExtensions = []pkix.Extension{acmeExtension}
+		if opts.duplicateExtension {
+			certTmpl.ExtraExtensions = append(certTmpl.ExtraExtensions, acmeExtension)
+		}
+	}
+	// Challenge certificates are self-signed unless an external issuer has been
+	// configured for the host.
+	parent, signer := &certTmpl, k
+	if opts.issuerCert != nil {
+		parent, signer = opts.issuerCert, opts.issuerKey
+	}
+	if opts.badSignature {
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed generating bad signature key: %s", err)
+		}
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, &certTmpl, parent, k.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating challenge certificate: %s", err)
+	}
+	chain := [][]byte{certBytes}
+	if opts.intermediate != nil {
+		chain = append(chain, opts.intermediate)
+	}
+	return &tls.Certificate{
+		Certificate: chain,
+		PrivateKey:  k,
+	}, nil
+}
+
+// challTLSServer is a *http.Server serving TLS-ALPN-01 challenges on one or
+// more addresses. All of the listeners share the server's TLS config, and so
+// the same GetCertificate handler.
+type challTLSServer struct {
+	*http.Server
+	addresses []string
+	bound     *boundAddrs
+	// connSlots limits the number of concurrent connections across all of the
+	// server's listeners when non-nil. See limitListener.
+	connSlots chan struct{}
+	// shutdownTimeout is how long Shutdown waits for connections to finish
+	// before closing them.
+	shutdownTimeout time.Duration
+}
+
+// Shutdown for a challTLSServer gracefully shuts down the underlying
+// http.Server. If connections are still active after the server's
+// shutdownTimeout they are closed so that a stuck handshake can't block
+// Shutdown indefinitely.
+func (c challTLSServer) Shutdown() error {
+	defer c.removeUnixSockets()
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+	defer cancel()
+	err := c.Server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return c.Server.Close()
+	}
+	return err
+}
+
+// unixAddrPrefix marks a TLS-ALPN-01 challenge server address as the path of
+// a Unix domain socket rather than a TCP address.
+const unixAddrPrefix = "unix:"
+
+// removeUnixSockets removes the socket files of any of the server's addresses
+// that are Unix domain sockets.
+func (c challTLSServer) removeUnixSockets() {
+	for _, address := range c.addresses {
+		if path := strings.TrimPrefix(address, unixAddrPrefix); path != address {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// listenTLSALPN binds the given TLS-ALPN-01 challenge server address. Addresses
+// starting with unixAddrPrefix are bound as Unix domain sockets, replacing any
+// socket file left behind by a previous run.
+func listenTLSALPN(address string) (net.Listener, error) {
+	if path := strings.TrimPrefix(address, unixAddrPrefix); path != address {
+		_ = os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", address)
+}
+
+// limitListener is a net.Listener that holds a slot in a shared semaphore for
+// every connection it accepts until the connection is closed. Once every slot
+// is taken Accept blocks, leaving further connections waiting in the OS
+// backlog before their TLS handshake starts.
+type limitListener struct {
+	net.Listener
+	slots     chan struct{}
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+func newLimitListener(l net.Listener, slots chan struct{}) limitListener {
+	return limitListener{
+		Listener:  l,
+		slots:     slots,
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+}
+
+func (l limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.slots }}, nil
+}
+
+// Close for a limitListener also unblocks an Accept call waiting for a slot.
+func (l limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn is a net.Conn accepted by a limitListener. Its slot is released the
+// first time it is closed.
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	c.releaseOnce.Do(c.release)
+	return c.Conn.Close()
+}
+
+func (c challTLSServer) Addrs() []string {
+	return c.bound.list()
+}
+
+// ListenAndServe for a challTLSServer binds each of the server's addresses and
+// serves TLS on all of them. It blocks until every listener has stopped and
+// returns the first error that isn't http.ErrServerClosed, if any.
+func (c challTLSServer) ListenAndServe() error {
+	var listeners []net.Listener
+	for _, address := range c.addresses {
+		l, err := listenTLSALPN(address)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	for i, l := range listeners {
+		c.bound.add(l.Addr())
+		if c.connSlots != nil {
+			listeners[i] = newLimitListener(l, c.connSlots)
+		}
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			// Since we set TLSConfig.GetCertificate, the certfile and keyFile
+			// arguments are ignored and we leave them blank.
+			errs <- c.Server.ServeTLS(l, "", "")
+			// ServeTLS doesn't close the listener if it fails before serving.
+			_ = l.Close()
+		}(l)
+	}
+
+	var firstErr error
+	for range listeners {
+		err := <-errs
+		if firstErr == nil || errors.Is(firstErr, http.ErrServerClosed) {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// tlsALPNOneServer creates an ACME TLS-ALPN-01 challenge server listening on
+// each of the config's TLSALPNOneAddrs. Challenge certificates are signed with
+// the provided key. The config must have been validated.
+func tlsALPNOneServer(challSrv *ChallSrv, key crypto.Signer, config Config) challengeServer {
+	tlsConfig := &tls.Config{
+		NextProtos:     append([]string{config.TLSALPNProtocol}, config.TLSALPNExtraProtocols...),
+		GetCertificate: challSrv.ServeChallengeCertFunc(key),
+		// Session tickets are the only way Go TLS servers support resumption.
+		SessionTicketsDisabled: config.TLSALPNDisableSessionTickets,
+		CipherSuites:           config.TLSALPNCipherSuites,
+		MinVersion:             config.TLSALPNMinVersion,
+		MaxVersion:             config.TLSALPNMaxVersion,
+	}
+	var challengeConfig *tls.Config
+	if config.TLSALPNClientCAs != nil {
+		// Handshakes negotiating only acme-tls/1 are switched to a copy of the
+		// config that doesn't ask for a client certificate.
+		challengeConfig = tlsConfig.Clone()
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.ClientCAs = config.TLSALPNClientCAs
+	}
+	tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		recordTLSHello(hello)
+		if alertConfig := challSrv.alertConfigForClient(hello); alertConfig != nil {
+			return alertConfig, nil
+		}
+		if challengeConfig != nil && challSrv.isChallengeHello(hello) {
+			return challengeConfig, nil
+		}
+		return nil, nil
+	}
+	srv := &http.Server{
+		// HTTPS requests made without negotiating acme-tls/1 are handled by the
+		// ChallSrv like they would be by the HTTPS HTTP-01 server.
+		Handler:      challSrv,
+		ReadTimeout:  config.TLSALPNReadTimeout,
+		WriteTimeout: config.TLSALPNWriteTimeout,
+		TLSConfig:    tlsConfig,
+	}
+	srv.SetKeepAlivesEnabled(config.TLSALPNKeepAlives)
+	if config.TLSALPNDebugEndpoint {
+		srv.ConnContext = tlsHelloConnContext
+	}
+	if len(config.TLSALPNCipherSuites) > 0 {
+		// net/http refuses to serve HTTP/2 if a cipher suite it requires is
+		// missing, so disable HTTP/2 rather than failing to start.
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	var connSlots chan struct{}
+	if config.TLSALPNMaxConcurrentHandshakes > 0 {
+		connSlots = make(chan struct{}, config.TLSALPNMaxConcurrentHandshakes)
+	}
+	return challTLSServer{
+		Server:          srv,
+		addresses:       config.TLSALPNOneAddrs,
+		bound:           &boundAddrs{},
+		connSlots:       connSlots,
+		shutdownTimeout: config.TLSALPNShutdownTimeout,
+	}
+}
@@ -0,0 +1,1267 @@
+package challtestsrv_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+func TestTLSALPNChallengeHostNormalized(t *testing.T) {
+	testCases := []struct {
+		name  string
+		added string
+		// lookup is passed to GetTLSALPNChallenge and sni is sent in the
+		// handshake. Go's TLS client strips a trailing dot from the SNI, so
+		// trailing dots are only checked for lookups.
+		lookup string
+		sni    string
+	}{
+		{name: "mixed case SNI", added: "example.com", lookup: "example.com", sni: "Example.COM"},
+		{name: "mixed case added", added: "EXAMPLE.com", lookup: "example.com", sni: "example.com"},
+		{name: "mixed case lookup", added: "example.com", lookup: "eXample.Com", sni: "example.com"},
+		{name: "trailing dot added", added: "example.com.", lookup: "example.com", sni: "example.com"},
+		{name: "trailing dot lookup", added: "example.com", lookup: "example.com.", sni: "example.com"},
+		{name: "mixed case and trailing dot", added: "Example.Com.", lookup: "EXAMPLE.COM.", sni: "eXaMpLe.CoM"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			srv.AddTLSALPNChallenge(tc.added, "key-authorization")
+
+			if content, ok := srv.GetTLSALPNChallenge(tc.lookup); !ok || content != "key-authorization" {
+				t.Errorf("GetTLSALPNChallenge(%q) = %q, %t after adding %q", tc.lookup, content, ok, tc.added)
+			}
+			state, err := handshakeTLSALPN(srv, tc.sni)
+			if err != nil {
+				t.Fatalf("handshake with SNI %q after adding %q failed: %s", tc.sni, tc.added, err)
+			}
+			if state.NegotiatedProtocol != challtestsrv.ACMETLS1Protocol {
+				t.Errorf("negotiated protocol %q, want %q", state.NegotiatedProtocol, challtestsrv.ACMETLS1Protocol)
+			}
+		})
+	}
+}
+
+func TestTLSALPNWildcardChallenge(t *testing.T) {
+	testCases := []struct {
+		name        string
+		challenges  map[string]string
+		sni         string
+		wantContent string
+		wantFound   bool
+	}{
+		{
+			name:        "one label below",
+			challenges:  map[string]string{"*.example.com": "wildcard"},
+			sni:         "foo.example.com",
+			wantContent: "wildcard",
+			wantFound:   true,
+		},
+		{
+			name:        "exact match wins",
+			challenges:  map[string]string{"*.example.com": "wildcard", "foo.example.com": "exact"},
+			sni:         "foo.example.com",
+			wantContent: "exact",
+			wantFound:   true,
+		},
+		{
+			name:        "wildcard alongside an exact match",
+			challenges:  map[string]string{"*.example.com": "wildcard", "foo.example.com": "exact"},
+			sni:         "bar.example.com",
+			wantContent: "wildcard",
+			wantFound:   true,
+		},
+		{
+			name:        "mixed case",
+			challenges:  map[string]string{"*.Example.com": "wildcard"},
+			sni:         "FOO.example.COM",
+			wantContent: "wildcard",
+			wantFound:   true,
+		},
+		{
+			name:       "two labels below",
+			challenges: map[string]string{"*.example.com": "wildcard"},
+			sni:        "a.foo.example.com",
+		},
+		{
+			name:       "base domain",
+			challenges: map[string]string{"*.example.com": "wildcard"},
+			sni:        "example.com",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			srv.AddTLSALPNChallenges(tc.challenges)
+
+			content, found := srv.GetTLSALPNChallenge(tc.sni)
+			if content != tc.wantContent || found != tc.wantFound {
+				t.Errorf("GetTLSALPNChallenge(%q) = %q, %t, want %q, %t",
+					tc.sni, content, found, tc.wantContent, tc.wantFound)
+			}
+			state, err := handshakeTLSALPN(srv, tc.sni)
+			if !tc.wantFound {
+				if err == nil {
+					t.Errorf("handshake with SNI %q succeeded without a matching challenge", tc.sni)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake with SNI %q failed: %s", tc.sni, err)
+			}
+			// The certificate must be for the matching challenge's key
+			// authorization, not just any challenge.
+			want := sha256.Sum256([]byte(tc.wantContent))
+			if got := acmeIdentifierDigest(t, state.PeerCertificates[0]); !bytes.Equal(got, want[:]) {
+				t.Errorf("certificate acmeIdentifier = %x, want the digest of %q", got, tc.wantContent)
+			}
+		})
+	}
+}
+
+func TestTLSALPNKeyType(t *testing.T) {
+	testCases := []struct {
+		name    string
+		keyType challtestsrv.TLSALPNKeyType
+		// wantRSABits is the modulus size of the certificate's RSA key, or
+		// zero for an ECDSA key.
+		wantRSABits int
+	}{
+		{name: "ECDSA", keyType: challtestsrv.TLSALPNKeyECDSA},
+		{name: "RSA 2048", keyType: challtestsrv.TLSALPNKeyRSA2048, wantRSABits: 2048},
+		{name: "RSA 3072", keyType: challtestsrv.TLSALPNKeyRSA3072, wantRSABits: 3072},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNKeyType: tc.keyType})
+			srv.AddTLSALPNChallenge("example.com", "key-authorization")
+
+			state, err := handshakeTLSALPN(srv, "example.com")
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			cert := state.PeerCertificates[0]
+			switch pub := cert.PublicKey.(type) {
+			case *ecdsa.PublicKey:
+				if tc.wantRSABits != 0 {
+					t.Errorf("certificate has an ECDSA key, want RSA %d", tc.wantRSABits)
+				}
+			case *rsa.PublicKey:
+				if pub.N.BitLen() != tc.wantRSABits {
+					t.Errorf("certificate has an RSA %d key, want %d", pub.N.BitLen(), tc.wantRSABits)
+				}
+			default:
+				t.Fatalf("certificate has an unexpected %T key", pub)
+			}
+			if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+				t.Errorf("certificate isn't self-signed with its key: %s", err)
+			}
+		})
+	}
+
+	_, err := challtestsrv.New(challtestsrv.Config{
+		TLSALPNOneAddrs: []string{"127.0.0.1:0"},
+		TLSALPNKeyType:  challtestsrv.TLSALPNKeyType(99),
+	})
+	if err == nil {
+		t.Error("New accepted an unknown TLSALPNKeyType")
+	}
+}
+
+func TestTLSALPNChallengeWithBadHash(t *testing.T) {
+	const host = "bad-hash.example.com"
+	const keyAuth = "key-authorization"
+	want := sha256.Sum256([]byte(keyAuth))
+
+	testCases := []struct {
+		name    string
+		add     func(*challtestsrv.ChallSrv)
+		wantBad bool
+	}{
+		{
+			name:    "bad hash",
+			add:     func(srv *challtestsrv.ChallSrv) { srv.AddTLSALPNChallengeWithBadHash(host, keyAuth) },
+			wantBad: true,
+		},
+		{
+			name: "replaced by a good challenge",
+			add: func(srv *challtestsrv.ChallSrv) {
+				srv.AddTLSALPNChallengeWithBadHash(host, keyAuth)
+				srv.AddTLSALPNChallenge(host, keyAuth)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			tc.add(srv)
+
+			state, err := handshakeTLSALPN(srv, host)
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			got := acmeIdentifierDigest(t, state.PeerCertificates[0])
+			if bad := !bytes.Equal(got, want[:]); bad != tc.wantBad {
+				t.Errorf("acmeIdentifier digest %x, want bad digest %t", got, tc.wantBad)
+			}
+		})
+	}
+}
+
+func TestTLSALPNRequests(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge("known.example.com", "key-authorization")
+
+	if _, err := handshakeTLSALPN(srv, "known.example.com"); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if _, err := handshakeTLSALPN(srv, "unknown.example.com"); err == nil {
+		t.Fatal("handshake for a name without a challenge succeeded")
+	}
+	if _, err := handshakeProtos(srv, "known.example.com"); err != nil {
+		t.Fatalf("handshake without ALPN failed: %s", err)
+	}
+
+	want := []challtestsrv.TLSALPNRequest{
+		{ServerName: "known.example.com", SupportedProtos: []string{challtestsrv.ACMETLS1Protocol}, ChallengeFound: true},
+		{ServerName: "unknown.example.com", SupportedProtos: []string{challtestsrv.ACMETLS1Protocol}},
+		// Handshakes that don't offer only acme-tls/1 never look up a
+		// challenge.
+		{ServerName: "known.example.com"},
+	}
+	if got := srv.TLSALPNRequests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TLSALPNRequests() = %+v, want %+v", got, want)
+	}
+
+	// Only the most recent handshakes are kept.
+	for i := 0; i < 150; i++ {
+		if _, err := handshakeTLSALPN(srv, "known.example.com"); err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+	}
+	got := srv.TLSALPNRequests()
+	if len(got) != 100 {
+		t.Fatalf("got %d TLSALPNRequests after 153 handshakes, want 100", len(got))
+	}
+	for _, request := range got {
+		if !request.ChallengeFound {
+			t.Errorf("got request %+v, want the older handshakes discarded", request)
+		}
+	}
+}
+
+func TestTLSALPNCurve(t *testing.T) {
+	testCases := []struct {
+		name      string
+		curve     elliptic.Curve
+		wantCurve elliptic.Curve
+	}{
+		{name: "default", wantCurve: elliptic.P256()},
+		{name: "P-384", curve: elliptic.P384(), wantCurve: elliptic.P384()},
+		{name: "P-521", curve: elliptic.P521(), wantCurve: elliptic.P521()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNCurve: tc.curve})
+			srv.AddTLSALPNChallenge("example.com", "key-authorization")
+
+			state, err := handshakeTLSALPN(srv, "example.com")
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			if pub, ok := state.PeerCertificates[0].PublicKey.(*ecdsa.PublicKey); !ok || pub.Curve != tc.wantCurve {
+				t.Errorf("challenge certificate key is on %s, want %s",
+					curveName(state.PeerCertificates[0].PublicKey), tc.wantCurve.Params().Name)
+			}
+
+			// The fallback certificate's key is on the same curve.
+			fallback, err := x509.ParseCertificate(srv.FallbackCertDER())
+			if err != nil {
+				t.Fatalf("parsing fallback certificate: %s", err)
+			}
+			if pub, ok := fallback.PublicKey.(*ecdsa.PublicKey); !ok || pub.Curve != tc.wantCurve {
+				t.Errorf("fallback certificate key is on %s, want %s",
+					curveName(fallback.PublicKey), tc.wantCurve.Params().Name)
+			}
+		})
+	}
+}
+
+// curveName returns the name of the curve of an ECDSA public key, or "none"
+// for other keys.
+func curveName(pub interface{}) string {
+	if pub, ok := pub.(*ecdsa.PublicKey); ok {
+		return pub.Curve.Params().Name
+	}
+	return "none"
+}
+
+func TestTLSALPNIPAddressChallenge(t *testing.T) {
+	testCases := []struct {
+		name    string
+		added   string
+		sni     string
+		wantSAN net.IP
+	}{
+		{
+			name:    "IPv4",
+			added:   "192.0.2.1",
+			sni:     "1.2.0.192.in-addr.arpa",
+			wantSAN: net.ParseIP("192.0.2.1"),
+		},
+		{
+			name:    "IPv6",
+			added:   "2001:db8::1",
+			sni:     "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+			wantSAN: net.ParseIP("2001:db8::1"),
+		},
+		{
+			name:    "added as a reverse name",
+			added:   "1.2.0.192.in-addr.arpa.",
+			sni:     "1.2.0.192.IN-ADDR.ARPA",
+			wantSAN: net.ParseIP("192.0.2.1"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+			srv.AddTLSALPNChallenge(tc.added, "key-authorization")
+
+			state, err := handshakeTLSALPN(srv, tc.sni)
+			if err != nil {
+				t.Fatalf("handshake with SNI %q failed: %s", tc.sni, err)
+			}
+			cert := state.PeerCertificates[0]
+			if len(cert.DNSNames) != 0 || len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(tc.wantSAN) {
+				t.Errorf("certificate has dNSNames %q and iPAddresses %v, want only iPAddress %s",
+					cert.DNSNames, cert.IPAddresses, tc.wantSAN)
+			}
+			want := sha256.Sum256([]byte("key-authorization"))
+			if got := acmeIdentifierDigest(t, cert); !bytes.Equal(got, want[:]) {
+				t.Errorf("certificate acmeIdentifier = %x, want the digest of the key authorization", got)
+			}
+		})
+	}
+}
+
+func TestTLSALPNMultipleAddrs(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		TLSALPNOneAddrs: []string{"127.0.0.1:0", "[::1]:0"},
+	})
+	srv.AddTLSALPNChallenge("example.com", "key-authorization")
+
+	addrs := srv.Status().TLSALPNOneAddrs
+	if len(addrs) != 2 {
+		t.Fatalf("TLS-ALPN-01 server is bound to %q, want two addresses", addrs)
+	}
+	for _, addr := range addrs {
+		state, err := dialTLS("tcp", addr, "example.com", challtestsrv.ACMETLS1Protocol)
+		if err != nil {
+			t.Errorf("handshake with %s failed: %s", addr, err)
+			continue
+		}
+		if len(acmeIdentifierExtensions(state.PeerCertificates[0])) != 1 {
+			t.Errorf("%s didn't serve a challenge certificate", addr)
+		}
+	}
+	if host, _, err := net.SplitHostPort(addrs[1]); err != nil || host != "::1" {
+		t.Errorf("second address is %q, want one on ::1", addrs[1])
+	}
+}
+
+func TestTLSALPNRequestCount(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge("counted.example.com", "key-authorization")
+
+	for _, sni := range []string{"counted.example.com", "COUNTED.example.com", "unknown.example.com"} {
+		_, _ = handshakeTLSALPN(srv, sni)
+	}
+	// Handshakes without acme-tls/1 don't look up a challenge.
+	if _, err := handshakeProtos(srv, "counted.example.com"); err != nil {
+		t.Fatalf("handshake without ALPN failed: %s", err)
+	}
+
+	testCases := []struct {
+		host string
+		want int
+	}{
+		{host: "counted.example.com", want: 2},
+		{host: "Counted.Example.Com.", want: 2},
+		{host: "unknown.example.com", want: 1},
+		{host: "never.example.com", want: 0},
+	}
+	for _, tc := range testCases {
+		if got := srv.TLSALPNRequestCount(tc.host); got != tc.want {
+			t.Errorf("TLSALPNRequestCount(%q) = %d, want %d", tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestListTLSALPNChallenges(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	if got := srv.ListTLSALPNChallenges(); len(got) != 0 {
+		t.Errorf("ListTLSALPNChallenges() = %q before adding challenges, want none", got)
+	}
+
+	srv.AddTLSALPNChallenge("a.example.com", "a")
+	srv.AddTLSALPNChallenge("B.example.com.", "b")
+	want := map[string]string{"a.example.com": "a", "b.example.com": "b"}
+	got := srv.ListTLSALPNChallenges()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListTLSALPNChallenges() = %q, want %q", got, want)
+	}
+
+	// The result is a copy.
+	got["c.example.com"] = "c"
+	delete(got, "a.example.com")
+	if _, found := srv.GetTLSALPNChallenge("c.example.com"); found {
+		t.Error("adding to the returned map added a challenge")
+	}
+	if _, found := srv.GetTLSALPNChallenge("a.example.com"); !found {
+		t.Error("deleting from the returned map deleted a challenge")
+	}
+}
+
+func TestDeleteAllTLSALPNChallenges(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenges(map[string]string{"a.example.com": "a", "b.example.com": "b"})
+	srv.AddTLSALPNChallengeWithBadHash("bad.example.com", "bad")
+	srv.AddHTTPOneChallenge("token", "http")
+
+	srv.DeleteAllTLSALPNChallenges()
+	if got := srv.ListTLSALPNChallenges(); len(got) != 0 {
+		t.Errorf("ListTLSALPNChallenges() = %q after DeleteAllTLSALPNChallenges, want none", got)
+	}
+	if _, err := handshakeTLSALPN(srv, "a.example.com"); err == nil {
+		t.Error("handshake for a deleted challenge succeeded")
+	}
+	// Other challenge types are kept.
+	if _, found := srv.GetHTTPOneChallenge("token"); !found {
+		t.Error("DeleteAllTLSALPNChallenges deleted an HTTP-01 challenge")
+	}
+
+	// Settings tied to the challenges are deleted too. UpdateTLSALPNChallenge
+	// would keep the bad hash if it were still set.
+	srv.UpdateTLSALPNChallenge("bad.example.com", "bad")
+	state, err := handshakeTLSALPN(srv, "bad.example.com")
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	want := sha256.Sum256([]byte("bad"))
+	if got := acmeIdentifierDigest(t, state.PeerCertificates[0]); !bytes.Equal(got, want[:]) {
+		t.Errorf("re-added challenge has digest %x, want the correct digest", got)
+	}
+}
+
+func TestTLSALPNReadTimeout(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNReadTimeout: timeout})
+
+	// A client that never sends its ClientHello is disconnected once the read
+	// timeout is over.
+	conn, err := net.Dial("tcp", srv.TLSALPNOneAddr())
+	if err != nil {
+		t.Fatalf("dialing: %s", err)
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read from an idle connection returned %v, want EOF", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > 4*time.Second {
+		t.Errorf("idle connection was closed after %s, want about %s", elapsed, timeout)
+	}
+}
+
+func TestTLSALPNLog(t *testing.T) {
+	var buf bytes.Buffer
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		TLSALPNLog: log.New(&buf, "", 0),
+	})
+	srv.AddTLSALPNChallenge("known.example.com", "key-authorization")
+
+	testCases := []struct {
+		name    string
+		sni     string
+		protos  []string
+		wantLog string
+	}{
+		{
+			name:    "challenge",
+			sni:     "known.example.com",
+			protos:  []string{challtestsrv.ACMETLS1Protocol},
+			wantLog: `TLS-ALPN-01 handshake sni="known.example.com" alpn=["acme-tls/1"] challengeFound=true action=served-challenge err=""`,
+		},
+		{
+			name:    "unknown SNI",
+			sni:     "unknown.example.com",
+			protos:  []string{challtestsrv.ACMETLS1Protocol},
+			wantLog: `TLS-ALPN-01 handshake sni="unknown.example.com" alpn=["acme-tls/1"] challengeFound=false action=unknown-sni err="unknown ClientHelloInfo.ServerName: unknown.example.com"`,
+		},
+		{
+			name:    "no ALPN",
+			sni:     "known.example.com",
+			wantLog: `TLS-ALPN-01 handshake sni="known.example.com" alpn=[] challengeFound=false action=served-fallback err=""`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			_, _ = handshakeProtos(srv, tc.sni, tc.protos...)
+			if got := strings.TrimSpace(buf.String()); got != tc.wantLog {
+				t.Errorf("logged %q, want %q", got, tc.wantLog)
+			}
+		})
+	}
+}
+
+func TestTLSALPNExtraProtocols(t *testing.T) {
+	testCases := []struct {
+		name           string
+		extraProtocols []string
+		protos         []string
+		wantProtocol   string
+		wantChallenge  bool
+		wantErr        bool
+	}{
+		{
+			name:           "acme-tls/1",
+			extraProtocols: []string{"h2", "http/1.1"},
+			protos:         []string{challtestsrv.ACMETLS1Protocol},
+			wantProtocol:   challtestsrv.ACMETLS1Protocol,
+			wantChallenge:  true,
+		},
+		{
+			name:           "extra protocol",
+			extraProtocols: []string{"h2", "http/1.1"},
+			protos:         []string{"http/1.1"},
+			wantProtocol:   "http/1.1",
+		},
+		{
+			name:    "no extra protocols",
+			protos:  []string{"http/1.1"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+				TLSALPNExtraProtocols: tc.extraProtocols,
+			})
+			srv.AddTLSALPNChallenge("example.com", "key-authorization")
+
+			state, err := handshakeProtos(srv, "example.com", tc.protos...)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("handshake offering %q succeeded, negotiating %q", tc.protos, state.NegotiatedProtocol)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake offering %q failed: %s", tc.protos, err)
+			}
+			if state.NegotiatedProtocol != tc.wantProtocol {
+				t.Errorf("negotiated %q, want %q", state.NegotiatedProtocol, tc.wantProtocol)
+			}
+			challenge := len(acmeIdentifierExtensions(state.PeerCertificates[0])) > 0
+			if challenge != tc.wantChallenge {
+				t.Errorf("got a challenge certificate %t, want %t", challenge, tc.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestTLSALPNAcmeIdentifierValue(t *testing.T) {
+	const keyAuth = "token.thumbprint"
+
+	got, err := challtestsrv.TLSALPNAcmeIdentifierValue(keyAuth)
+	if err != nil {
+		t.Fatalf("TLSALPNAcmeIdentifierValue: %s", err)
+	}
+	// An OCTET STRING tag and length followed by the 32 byte digest.
+	digest := sha256.Sum256([]byte(keyAuth))
+	want := append([]byte{0x04, 0x20}, digest[:]...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("TLSALPNAcmeIdentifierValue(%q) = %x, want %x", keyAuth, got, want)
+	}
+
+	// It matches the extension the challenge server serves.
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge("example.com", keyAuth)
+	state, err := handshakeTLSALPN(srv, "example.com")
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	exts := acmeIdentifierExtensions(state.PeerCertificates[0])
+	if len(exts) != 1 || !bytes.Equal(exts[0].Value, got) {
+		t.Errorf("served acmeIdentifier extensions %v, want one with value %x", exts, got)
+	}
+}
+
+func TestTLSALPNShutdownTimeout(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	srv, shutdown := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		TLSALPNReadTimeout:     time.Minute,
+		TLSALPNShutdownTimeout: timeout,
+	})
+
+	// A client that stops halfway through sending a request over a connection
+	// that didn't negotiate acme-tls/1 would hold up a graceful shutdown until
+	// the read timeout.
+	conn, err := tls.Dial("tcp", srv.TLSALPNOneAddr(), &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("dialing: %s", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\n"); err != nil {
+		t.Fatalf("writing request: %s", err)
+	}
+	// Give the server time to start reading the request.
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	shutdown()
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > 10*time.Second {
+		t.Errorf("Shutdown took %s with a stuck connection, want about %s", elapsed, timeout)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("the stuck connection is still open after Shutdown")
+	}
+}
+
+func TestTLSALPNKeepAlives(t *testing.T) {
+	for _, keepAlives := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep-alives %t", keepAlives), func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNKeepAlives: keepAlives})
+			srv.AddHTTPOneChallenge("token", "key-authorization")
+
+			handshakes := 0
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					VerifyConnection: func(tls.ConnectionState) error {
+						handshakes++
+						return nil
+					},
+				},
+			}}
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get("https://" + srv.TLSALPNOneAddr() + "/.well-known/acme-challenge/token")
+				if err != nil {
+					t.Fatalf("request failed: %s", err)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			wantHandshakes := 2
+			if keepAlives {
+				wantHandshakes = 1
+			}
+			if handshakes != wantHandshakes {
+				t.Errorf("two requests took %d handshakes, want %d", handshakes, wantHandshakes)
+			}
+		})
+	}
+}
+
+func TestTLSALPNPublicKey(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge("example.com", "key-authorization")
+
+	state, err := handshakeTLSALPN(srv, "example.com")
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	cert := state.PeerCertificates[0]
+	pub, ok := srv.TLSALPNPublicKey().(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("TLSALPNPublicKey() is a %T, want an ECDSA key", srv.TLSALPNPublicKey())
+	}
+	if !pub.Equal(cert.PublicKey) {
+		t.Error("TLSALPNPublicKey() isn't the challenge certificate's key")
+	}
+	digest := sha256.Sum256(cert.RawTBSCertificate)
+	if !ecdsa.VerifyASN1(pub, digest[:], cert.Signature) {
+		t.Error("challenge certificate signature doesn't verify with TLSALPNPublicKey()")
+	}
+
+	// Without a TLS-ALPN-01 server there is no key.
+	noTLS, err := challtestsrv.New(challtestsrv.Config{HTTPOneAddrs: []string{"127.0.0.1:0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := noTLS.TLSALPNPublicKey(); key != nil {
+		t.Errorf("TLSALPNPublicKey() = %v without a TLS-ALPN-01 server, want nil", key)
+	}
+}
+
+func TestTLSALPNClientCAs(t *testing.T) {
+	const host = "mtls.example.com"
+	ca, caKey := newTestCA(t, "client CA")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating client key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, clientKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("issuing client certificate: %s", err)
+	}
+	clientCert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: clientKey}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNClientCAs: pool})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	testCases := []struct {
+		name         string
+		protos       []string
+		certificates []tls.Certificate
+		wantErr      bool
+	}{
+		{name: "acme-tls/1 without a client certificate", protos: []string{challtestsrv.ACMETLS1Protocol}},
+		{name: "no ALPN without a client certificate", wantErr: true},
+		{name: "no ALPN with a client certificate", certificates: []tls.Certificate{clientCert}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err := srv.TLSALPNHandshake(ctx, &tls.Config{
+				ServerName:         host,
+				NextProtos:         tc.protos,
+				Certificates:       tc.certificates,
+				InsecureSkipVerify: true,
+				// A TLS 1.3 client finishes its side of the handshake before
+				// the server checks its certificate, so only TLS 1.2 reports
+				// the rejection from the handshake.
+				MaxVersion: tls.VersionTLS12,
+			})
+			if tc.wantErr && err == nil {
+				t.Error("handshake succeeded, want an error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("handshake failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestTLSALPNDisableSessionTickets(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("disabled %t", disabled), func(t *testing.T) {
+			const host = "tickets.example.com"
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNDisableSessionTickets: disabled})
+			srv.AddTLSALPNChallenge(host, "key-authorization")
+
+			clientConfig := &tls.Config{
+				ServerName:         host,
+				NextProtos:         []string{challtestsrv.ACMETLS1Protocol},
+				InsecureSkipVerify: true,
+				ClientSessionCache: tls.NewLRUClientSessionCache(1),
+				// TLS 1.2 sends the ticket during the handshake, so the client
+				// has it without reading from the connection afterwards.
+				MaxVersion: tls.VersionTLS12,
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := srv.TLSALPNHandshake(ctx, clientConfig); err != nil {
+				t.Fatalf("first handshake failed: %s", err)
+			}
+			state, err := srv.TLSALPNHandshake(ctx, clientConfig)
+			if err != nil {
+				t.Fatalf("second handshake failed: %s", err)
+			}
+			if state.DidResume == disabled {
+				t.Errorf("second handshake DidResume = %t, want %t", state.DidResume, !disabled)
+			}
+		})
+	}
+}
+
+func TestUpdateTLSALPNChallenge(t *testing.T) {
+	const host = "update.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+
+	if old, existed := srv.UpdateTLSALPNChallenge(host, "first"); existed || old != "" {
+		t.Errorf("UpdateTLSALPNChallenge of a new host = %q, %t, want \"\", false", old, existed)
+	}
+	if old, existed := srv.UpdateTLSALPNChallenge(host, "second"); !existed || old != "first" {
+		t.Errorf("UpdateTLSALPNChallenge = %q, %t, want %q, true", old, existed, "first")
+	}
+
+	state, err := handshakeTLSALPN(srv, host)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	want := sha256.Sum256([]byte("second"))
+	if digest := acmeIdentifierDigest(t, state.PeerCertificates[0]); !bytes.Equal(digest, want[:]) {
+		t.Errorf("acmeIdentifier digest = %x, want the digest of the updated key authorization", digest)
+	}
+}
+
+func TestLastTLSALPNCert(t *testing.T) {
+	const host = "last.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	if der, found := srv.LastTLSALPNCert(host); found || der != nil {
+		t.Errorf("LastTLSALPNCert before any handshake = %x, %t, want nil, false", der, found)
+	}
+
+	var last []byte
+	for i := 0; i < 2; i++ {
+		state, err := handshakeTLSALPN(srv, host)
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		last = state.PeerCertificates[0].Raw
+	}
+	// The host is normalized like the challenge host.
+	der, found := srv.LastTLSALPNCert("LAST.example.com.")
+	if !found {
+		t.Fatal("LastTLSALPNCert found no certificate after a handshake")
+	}
+	if !bytes.Equal(der, last) {
+		t.Error("LastTLSALPNCert isn't the certificate served by the last handshake")
+	}
+}
+
+func TestTLSALPNChallengePerSource(t *testing.T) {
+	const host = "split.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge(host, "default")
+	srv.AddTLSALPNChallengePerSource(host, map[string]string{
+		"127.0.0.1": "first",
+		"127.0.0.2": "second",
+	})
+
+	testCases := []struct {
+		source  string
+		keyAuth string
+	}{
+		{source: "127.0.0.1", keyAuth: "first"},
+		{source: "127.0.0.2", keyAuth: "second"},
+		{source: "127.0.0.3", keyAuth: "default"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.source, func(t *testing.T) {
+			dialer := &tls.Dialer{
+				NetDialer: &net.Dialer{
+					Timeout:   5 * time.Second,
+					LocalAddr: &net.TCPAddr{IP: net.ParseIP(tc.source)},
+				},
+				Config: &tls.Config{
+					ServerName:         host,
+					NextProtos:         []string{challtestsrv.ACMETLS1Protocol},
+					InsecureSkipVerify: true,
+				},
+			}
+			conn, err := dialer.Dial("tcp", srv.TLSALPNOneAddr())
+			if err != nil {
+				t.Fatalf("handshake from %s failed: %s", tc.source, err)
+			}
+			defer conn.Close()
+			cert := conn.(*tls.Conn).ConnectionState().PeerCertificates[0]
+			want := sha256.Sum256([]byte(tc.keyAuth))
+			if digest := acmeIdentifierDigest(t, cert); !bytes.Equal(digest, want[:]) {
+				t.Errorf("client at %s got the digest %x, want the digest of %q", tc.source, digest, tc.keyAuth)
+			}
+		})
+	}
+}
+
+func TestTLSALPNProtocol(t *testing.T) {
+	const (
+		host     = "protocol.example.com"
+		protocol = "acme-tls/2"
+	)
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNProtocol: protocol})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	state, err := handshakeProtos(srv, host, protocol)
+	if err != nil {
+		t.Fatalf("handshake offering %s failed: %s", protocol, err)
+	}
+	if state.NegotiatedProtocol != protocol {
+		t.Errorf("negotiated protocol %q, want %q", state.NegotiatedProtocol, protocol)
+	}
+	want := sha256.Sum256([]byte("key-authorization"))
+	if digest := acmeIdentifierDigest(t, state.PeerCertificates[0]); !bytes.Equal(digest, want[:]) {
+		t.Errorf("acmeIdentifier digest = %x, want %x", digest, want)
+	}
+
+	// acme-tls/1 is no longer negotiated.
+	if state, err := handshakeTLSALPN(srv, host); err == nil {
+		t.Errorf("handshake offering acme-tls/1 negotiated %q, want an error", state.NegotiatedProtocol)
+	}
+}
+
+func TestValidateTLSALPNCert(t *testing.T) {
+	testCases := []struct {
+		name string
+		host string
+		// sni defaults to host.
+		sni     string
+		keyAuth string
+		mock    func(srv *challtestsrv.ChallSrv, host string)
+		wantErr string
+	}{
+		{name: "valid", host: "valid.example.com", keyAuth: "key-authorization"},
+		{
+			// RFC 8738 uses the reverse DNS name of an IP address as the SNI.
+			name:    "valid IP address",
+			host:    "192.0.2.1",
+			sni:     "1.2.0.192.in-addr.arpa",
+			keyAuth: "key-authorization",
+		},
+		{
+			name:    "wrong key authorization",
+			host:    "wrong-ka.example.com",
+			keyAuth: "other-key-authorization",
+			wantErr: "value does not match",
+		},
+		{
+			name:    "extra SAN",
+			host:    "extra.example.com",
+			keyAuth: "key-authorization",
+			mock: func(srv *challtestsrv.ChallSrv, host string) {
+				srv.SetTLSALPNExtraSANs(host, []string{"other.example.com"})
+			},
+			wantErr: "exactly one SAN",
+		},
+		{
+			name:    "wrong SAN",
+			host:    "right.example.com",
+			keyAuth: "key-authorization",
+			mock: func(srv *challtestsrv.ChallSrv, host string) {
+				srv.SetTLSALPNWrongSAN(host, "wrong.example.com")
+			},
+			wantErr: "does not match",
+		},
+		{
+			name:    "no extension",
+			host:    "omit.example.com",
+			keyAuth: "key-authorization",
+			mock: func(srv *challtestsrv.ChallSrv, host string) {
+				srv.SetTLSALPNOmitExtension(host, true)
+			},
+			wantErr: "no acmeIdentifier extension",
+		},
+		{
+			name:    "non-critical extension",
+			host:    "noncritical.example.com",
+			keyAuth: "key-authorization",
+			mock: func(srv *challtestsrv.ChallSrv, host string) {
+				srv.SetTLSALPNExtensionCritical(host, false)
+			},
+			wantErr: "not critical",
+		},
+		{
+			name:    "bare digest",
+			host:    "raw.example.com",
+			keyAuth: "key-authorization",
+			mock: func(srv *challtestsrv.ChallSrv, host string) {
+				srv.SetTLSALPNRawHash(host, true)
+			},
+			wantErr: "value does not match",
+		},
+	}
+
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.AddTLSALPNChallenge(tc.host, "key-authorization")
+			if tc.mock != nil {
+				tc.mock(srv, tc.host)
+			}
+			sni := tc.sni
+			if sni == "" {
+				sni = tc.host
+			}
+			state, err := handshakeTLSALPN(srv, sni)
+			if err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			err = challtestsrv.ValidateTLSALPNCert(state.PeerCertificates[0], tc.host, tc.keyAuth)
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("ValidateTLSALPNCert = %q, want nil", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("ValidateTLSALPNCert = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestMakeTLSALPNCert(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+	testCases := []struct {
+		name string
+		host string
+		// validateHost defaults to host.
+		validateHost string
+	}{
+		{name: "DNS name", host: "make.example.com"},
+		{name: "IP address", host: "192.0.2.1"},
+		{name: "reverse DNS name", host: "1.2.0.192.in-addr.arpa", validateHost: "192.0.2.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tlsCert, err := challtestsrv.MakeTLSALPNCert(tc.host, "key-authorization", key)
+			if err != nil {
+				t.Fatalf("MakeTLSALPNCert failed: %s", err)
+			}
+			if tlsCert.PrivateKey != key {
+				t.Error("MakeTLSALPNCert's certificate doesn't use the given key")
+			}
+			cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+			if err != nil {
+				t.Fatalf("parsing challenge certificate: %s", err)
+			}
+			if !key.PublicKey.Equal(cert.PublicKey) {
+				t.Error("challenge certificate's public key isn't the given key's")
+			}
+			validateHost := tc.validateHost
+			if validateHost == "" {
+				validateHost = tc.host
+			}
+			if err := challtestsrv.ValidateTLSALPNCert(cert, validateHost, "key-authorization"); err != nil {
+				t.Errorf("ValidateTLSALPNCert = %q, want nil", err)
+			}
+			if err := challtestsrv.ValidateTLSALPNCert(cert, validateHost, "other-key-authorization"); err == nil {
+				t.Error("ValidateTLSALPNCert succeeded with a different key authorization")
+			}
+		})
+	}
+}
+
+func TestTLSALPNUnixSocket(t *testing.T) {
+	const host = "unix.example.com"
+	path := filepath.Join(t.TempDir(), "tlsalpn.sock")
+	srv, cleanup := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		TLSALPNOneAddrs: []string{"unix:" + path},
+	})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	state, err := dialTLS("unix", path, host, challtestsrv.ACMETLS1Protocol)
+	if err != nil {
+		t.Fatalf("handshake over the Unix socket failed: %s", err)
+	}
+	want := sha256.Sum256([]byte("key-authorization"))
+	if digest := acmeIdentifierDigest(t, state.PeerCertificates[0]); !bytes.Equal(digest, want[:]) {
+		t.Errorf("acmeIdentifier digest = %x, want %x", digest, want)
+	}
+
+	// The socket file is removed by Shutdown.
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file still exists after Shutdown: %v", err)
+	}
+}
+
+func TestTLSALPNMaxConcurrentHandshakes(t *testing.T) {
+	const host = "limited.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNMaxConcurrentHandshakes: 1})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	// An idle connection takes the only slot.
+	idle, err := net.Dial("tcp", srv.TLSALPNOneAddr())
+	if err != nil {
+		t.Fatalf("dialing: %s", err)
+	}
+	defer idle.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := dialTLS("tcp", srv.TLSALPNOneAddr(), host, challtestsrv.ACMETLS1Protocol)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("handshake finished with the only slot taken: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Closing the idle connection frees the slot for the waiting handshake.
+	idle.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("handshake failed once the slot was free: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake didn't finish once the slot was free")
+	}
+}
+
+func TestTLSALPNCipherSuitesAndVersions(t *testing.T) {
+	const host = "ciphers.example.com"
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{
+		TLSALPNCipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		TLSALPNMaxVersion:   tls.VersionTLS12,
+	})
+	srv.AddTLSALPNChallenge(host, "key-authorization")
+
+	handshake := func(clientConfig *tls.Config) (tls.ConnectionState, error) {
+		clientConfig.ServerName = host
+		clientConfig.NextProtos = []string{challtestsrv.ACMETLS1Protocol}
+		clientConfig.InsecureSkipVerify = true
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.TLSALPNHandshake(ctx, clientConfig)
+	}
+
+	state, err := handshake(&tls.Config{})
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if state.Version != tls.VersionTLS12 {
+		t.Errorf("negotiated version %x, want TLS 1.2", state.Version)
+	}
+	if state.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("negotiated cipher suite %s, want %s", tls.CipherSuiteName(state.CipherSuite),
+			tls.CipherSuiteName(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256))
+	}
+
+	// Clients that only offer other cipher suites or versions fail.
+	if _, err := handshake(&tls.Config{
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+	}); err == nil {
+		t.Error("handshake offering only a cipher suite the server doesn't accept succeeded")
+	}
+	if _, err := handshake(&tls.Config{MinVersion: tls.VersionTLS13}); err == nil {
+		t.Error("handshake offering only TLS 1.3 succeeded")
+	}
+
+	// The network listener serves too, even though the cipher suites HTTP/2
+	// requires are missing.
+	if _, err := dialTLS("tcp", srv.TLSALPNOneAddr(), host, challtestsrv.ACMETLS1Protocol); err != nil {
+		t.Errorf("handshake over the network failed: %s", err)
+	}
+}
+
+func TestServeChallengeCertFuncErrors(t *testing.T) {
+	srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{})
+	srv.AddTLSALPNChallenge("known.example.com", "key-authorization")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getCert := srv.ServeChallengeCertFunc(key)
+
+	_, err = getCert(&tls.ClientHelloInfo{
+		ServerName:      "unknown.example.com",
+		SupportedProtos: []string{challtestsrv.ACMETLS1Protocol},
+	})
+	if !errors.Is(err, challtestsrv.ErrUnknownSNI) {
+		t.Fatalf("GetCertificate for an unknown name returned %v, want ErrUnknownSNI", err)
+	}
+	if errors.Is(err, challtestsrv.ErrExtensionMarshal) {
+		t.Errorf("GetCertificate for an unknown name returned %v, which is ErrExtensionMarshal", err)
+	}
+	// The wrapping error names the SNI.
+	if !strings.Contains(err.Error(), "unknown.example.com") {
+		t.Errorf("error %q doesn't name the SNI", err)
+	}
+
+	cert, err := getCert(&tls.ClientHelloInfo{
+		ServerName:      "known.example.com",
+		SupportedProtos: []string{challtestsrv.ACMETLS1Protocol},
+	})
+	if err != nil || cert == nil {
+		t.Errorf("GetCertificate for a known name = %v, %v, want a certificate", cert, err)
+	}
+}
+
+func TestTLSALPNStrictProtocol(t *testing.T) {
+	strict, lenient := true, false
+	testCases := []struct {
+		name          string
+		strict        *bool
+		opts          []challtestsrv.Option
+		wantChallenge bool
+	}{
+		{name: "default"},
+		{name: "strict", strict: &strict},
+		{name: "lenient", strict: &lenient, wantChallenge: true},
+		{name: "lenient option", opts: []challtestsrv.Option{challtestsrv.WithTLSALPNStrictProtocol(false)}, wantChallenge: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, err := challtestsrv.New(challtestsrv.Config{
+				TLSALPNOneAddrs:       []string{"127.0.0.1:0"},
+				TLSALPNExtraProtocols: []string{"h2"},
+				TLSALPNStrictProtocol: tc.strict,
+				Log:                   log.New(io.Discard, "", 0),
+			}, tc.opts...)
+			if err != nil {
+				t.Fatalf("creating challenge server: %s", err)
+			}
+			srv.AddTLSALPNChallenge("example.com", "key-authorization")
+
+			// Offering only acme-tls/1 always gets a challenge certificate.
+			state, err := handshakeTLSALPN(srv, "example.com")
+			if err != nil {
+				t.Fatalf("handshake offering only acme-tls/1 failed: %s", err)
+			}
+			if len(acmeIdentifierExtensions(state.PeerCertificates[0])) == 0 {
+				t.Error("handshake offering only acme-tls/1 didn't get a challenge certificate")
+			}
+
+			state, err = handshakeProtos(srv, "example.com", "h2", challtestsrv.ACMETLS1Protocol)
+			if err != nil {
+				t.Fatalf("handshake offering h2 and acme-tls/1 failed: %s", err)
+			}
+			challenge := len(acmeIdentifierExtensions(state.PeerCertificates[0])) > 0
+			if challenge != tc.wantChallenge {
+				t.Errorf("handshake offering h2 and acme-tls/1 got a challenge certificate %t, want %t", challenge, tc.wantChallenge)
+			}
+			if challenge && state.NegotiatedProtocol != challtestsrv.ACMETLS1Protocol {
+				t.Errorf("challenge certificate served over %q, want acme-tls/1", state.NegotiatedProtocol)
+			}
+		})
+	}
+}
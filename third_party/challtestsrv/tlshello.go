@@ -0,0 +1,62 @@
+package challtestsrv
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// TLSHelloDebugPath is the path on which a TLS-ALPN-01 challenge server with
+// Config.TLSALPNDebugEndpoint set describes the TLS handshake of the request's
+// connection, for requests made without negotiating acme-tls/1.
+const TLSHelloDebugPath = "/challtestsrv/tls-hello"
+
+// TLSHelloDebug is the JSON body served on TLSHelloDebugPath.
+type TLSHelloDebug struct {
+	// ServerName is the SNI sent by the client, if any.
+	ServerName string `json:"serverName"`
+	// OfferedProtocols are the ALPN protocols offered by the client, if any.
+	OfferedProtocols []string `json:"offeredProtocols"`
+	// NegotiatedProtocol is the ALPN protocol that was negotiated, if any.
+	NegotiatedProtocol string `json:"negotiatedProtocol"`
+}
+
+// tlsHelloKey is the context key of the *TLSHelloDebug recorded for each
+// connection of a TLS-ALPN-01 challenge server with a debug endpoint.
+type tlsHelloKey struct{}
+
+// tlsHelloConnContext is an http.Server ConnContext function that adds an
+// empty *TLSHelloDebug to each connection's context for recordTLSHello to fill
+// in during the handshake.
+func tlsHelloConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, tlsHelloKey{}, &TLSHelloDebug{})
+}
+
+// recordTLSHello records the SNI and ALPN protocols of hello for the debug
+// endpoint if its connection was set up by tlsHelloConnContext.
+func recordTLSHello(hello *tls.ClientHelloInfo) {
+	debug, ok := hello.Context().Value(tlsHelloKey{}).(*TLSHelloDebug)
+	if !ok {
+		return
+	}
+	debug.ServerName = hello.ServerName
+	debug.OfferedProtocols = hello.SupportedProtos
+}
+
+// serveTLSHelloDebug writes the TLSHelloDebug recorded for the connection of r
+// as JSON. It returns false without writing anything if nothing was recorded,
+// i.e. the request wasn't made to a TLS-ALPN-01 challenge server with
+// a debug endpoint.
+func serveTLSHelloDebug(w http.ResponseWriter, r *http.Request) bool {
+	debug, ok := r.Context().Value(tlsHelloKey{}).(*TLSHelloDebug)
+	if !ok || r.TLS == nil {
+		return false
+	}
+	body := *debug
+	body.NegotiatedProtocol = r.TLS.NegotiatedProtocol
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+	return true
+}
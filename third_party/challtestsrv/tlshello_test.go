@@ -0,0 +1,83 @@
+package challtestsrv_test
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+)
+
+func TestTLSHelloDebug(t *testing.T) {
+	testCases := []struct {
+		name   string
+		debug  bool
+		protos []string
+		// want is nil if the request isn't answered with a TLSHelloDebug.
+		want *challtestsrv.TLSHelloDebug
+	}{
+		{
+			name:   "enabled",
+			debug:  true,
+			protos: []string{"http/1.1", "foo"},
+			want: &challtestsrv.TLSHelloDebug{
+				ServerName:         "debug.example.com",
+				OfferedProtocols:   []string{"http/1.1", "foo"},
+				NegotiatedProtocol: "http/1.1",
+			},
+		},
+		{
+			name:  "enabled without ALPN",
+			debug: true,
+			want:  &challtestsrv.TLSHelloDebug{ServerName: "debug.example.com"},
+		},
+		{name: "disabled", protos: []string{"http/1.1"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := challtestsrvtest.NewTestServer(t, challtestsrv.Config{TLSALPNDebugEndpoint: tc.debug})
+			client := &http.Client{
+				Timeout: 5 * time.Second,
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						ServerName:         "debug.example.com",
+						NextProtos:         tc.protos,
+						InsecureSkipVerify: true,
+					},
+				},
+			}
+			defer client.CloseIdleConnections()
+
+			resp, err := client.Get("https://" + srv.TLSALPNOneAddr() + challtestsrv.TLSHelloDebugPath)
+			if err != nil {
+				t.Fatalf("requesting the debug endpoint: %s", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			if tc.want == nil {
+				// Like any other unknown path.
+				if body, _ := io.ReadAll(resp.Body); len(body) != 0 {
+					t.Errorf("got body %q without TLSALPNDebugEndpoint, want none", body)
+				}
+				return
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want %q", ct, "application/json")
+			}
+			var got challtestsrv.TLSHelloDebug
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding TLSHelloDebug: %s", err)
+			}
+			if !reflect.DeepEqual(got, *tc.want) {
+				t.Errorf("TLSHelloDebug = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package va
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/challtestsrv"
+	"github.com/letsencrypt/challtestsrv/challtestsrvtest"
+	"github.com/miekg/dns"
+)
+
+// setupChallTestSrv returns a VA that resolves names with the DNS-01 server of
+// a new challtestsrv.ChallSrv and validates against its HTTP-01 and
+// TLS-ALPN-01 servers, along with the ChallSrv. Names resolve to 127.0.0.1
+// only, the address the ChallSrv listens on, unless the test changes the
+// default addresses.
+func setupChallTestSrv(t *testing.T, cfg challtestsrv.Config) (*ValidationAuthorityImpl, *challtestsrv.ChallSrv) {
+	t.Helper()
+	srv, _ := challtestsrvtest.NewTestServer(t, cfg)
+	srv.SetDefaultDNSIPv6("")
+
+	va, log := setup(nil, 0, "", nil)
+	va.httpPort = addrPort(t, srv.HTTPOneAddr())
+	va.tlsPort = addrPort(t, srv.TLSALPNOneAddr())
+	provider, err := bdns.NewStaticProvider([]string{srv.DNSOneAddr()})
+	test.AssertNotError(t, err, "Couldn't make new static provider")
+	va.dnsClient = bdns.NewTest(
+		time.Second*5,
+		provider,
+		metrics.NoopRegisterer,
+		clock.New(),
+		1,
+		log)
+	return va, srv
+}
+
+func addrPort(t *testing.T, addr string) int {
+	t.Helper()
+	_, portString, err := net.SplitHostPort(addr)
+	test.AssertNotError(t, err, "Failed to split address")
+	port, err := strconv.Atoi(portString)
+	test.AssertNotError(t, err, "Failed to parse port")
+	return port
+}
+
+func TestHTTPChallTestSrvResponseStatusRedirect(t *testing.T) {
+	const target = "redirect-target"
+	targetURL := "http://example.com/.well-known/acme-challenge/" + target
+
+	testCases := []struct {
+		name     string
+		status   int
+		location string
+		wantURLs []string
+	}{
+		{
+			name:     "301 with location",
+			status:   301,
+			location: targetURL,
+			wantURLs: []string{"http://example.com/.well-known/acme-challenge/" + expectedToken, targetURL},
+		},
+		{
+			name:     "307 with location",
+			status:   307,
+			location: targetURL,
+			wantURLs: []string{"http://example.com/.well-known/acme-challenge/" + expectedToken, targetURL},
+		},
+		{
+			name:   "302 without location",
+			status: 302,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			srv.AddHTTPOneChallenge(target, expectedKeyAuthorization)
+			srv.SetHTTPOneResponseStatus(expectedToken, tc.status)
+			srv.SetHTTPOneResponseLocation(expectedToken, tc.location)
+
+			records, prob := va.validateHTTP01(ctx, dnsi("example.com"), httpChallenge())
+			if tc.wantURLs == nil {
+				test.Assert(t, prob != nil, "Validation of a 3xx without a Location should fail")
+				test.AssertEquals(t, len(records), 1)
+				return
+			}
+			if prob != nil {
+				t.Fatalf("Validation failed: %s", prob)
+			}
+			var urls []string
+			for _, record := range records {
+				urls = append(urls, record.URL)
+			}
+			test.AssertDeepEquals(t, urls, tc.wantURLs)
+		})
+	}
+}
+
+// dnsChallengeDigest returns the TXT record value that validates chall.
+func dnsChallengeDigest(chall core.Challenge) string {
+	digest := sha256.Sum256([]byte(chall.ProvidedKeyAuthorization))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+func TestDNSChallTestSrvMultipleTXT(t *testing.T) {
+	chall := dnsChallenge()
+	digest := dnsChallengeDigest(chall)
+
+	testCases := []struct {
+		name   string
+		values []string
+		valid  bool
+	}{
+		{name: "only first correct", values: []string{digest, "wrong"}, valid: true},
+		{name: "only second correct", values: []string{"wrong", digest}, valid: true},
+		{name: "neither correct", values: []string{"wrong", "also wrong"}, valid: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			for _, value := range tc.values {
+				srv.AddDNSOneChallenge("_acme-challenge.example.com.", value)
+			}
+
+			_, prob := va.validateDNS01(ctx, dnsi("example.com"), chall)
+			if tc.valid && prob != nil {
+				t.Errorf("Validation failed: %s", prob)
+			}
+			if !tc.valid && prob == nil {
+				t.Error("Validation succeeded without a correct TXT record")
+			}
+		})
+	}
+}
+
+func TestDNSChallTestSrvCNAMETarget(t *testing.T) {
+	chall := dnsChallenge()
+	const target = "example.com.validation.example.net."
+
+	testCases := []struct {
+		name    string
+		txtHost string
+		valid   bool
+	}{
+		{name: "TXT at CNAME target", txtHost: target, valid: true},
+		{name: "no TXT at CNAME target", txtHost: "", valid: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			srv.AddDNSCNAMERecord("_acme-challenge.example.com", target)
+			if tc.txtHost != "" {
+				srv.AddDNSOneChallenge(tc.txtHost, dnsChallengeDigest(chall))
+			}
+
+			_, prob := va.validateDNS01(ctx, dnsi("example.com"), chall)
+			if tc.valid && prob != nil {
+				t.Errorf("Validation failed: %s", prob)
+			}
+			if !tc.valid && prob == nil {
+				t.Error("Validation succeeded without a TXT record at the CNAME target")
+			}
+		})
+	}
+}
+
+func TestHTTPChallTestSrvMultipleAddresses(t *testing.T) {
+	testCases := []struct {
+		name         string
+		a            []string
+		aaaa         []string
+		wantResolved []string
+		// wantUsed is the address used by each validation record, one record
+		// per attempt.
+		wantUsed []string
+	}{
+		{
+			name:         "several A records",
+			a:            []string{"127.0.0.1", "127.0.0.2"},
+			wantResolved: []string{"127.0.0.1", "127.0.0.2"},
+			wantUsed:     []string{"127.0.0.1"},
+		},
+		{
+			// Nothing listens on ::1, so the VA falls back to IPv4.
+			name:         "A and AAAA records",
+			a:            []string{"127.0.0.1"},
+			aaaa:         []string{"::1", "::2"},
+			wantResolved: []string{"127.0.0.1", "::1", "::2"},
+			wantUsed:     []string{"::1", "127.0.0.1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			srv.SetDefaultDNSIPv4("")
+			srv.AddDNSARecord("example.com", tc.a)
+			srv.AddDNSAAAARecord("example.com", tc.aaaa)
+			srv.AddHTTPOneChallenge(expectedToken, expectedKeyAuthorization)
+
+			records, prob := va.validateHTTP01(ctx, dnsi("example.com"), httpChallenge())
+			if prob != nil {
+				t.Fatalf("Validation failed: %s", prob)
+			}
+			var used []string
+			for _, record := range records {
+				var resolved []string
+				for _, ip := range record.AddressesResolved {
+					resolved = append(resolved, ip.String())
+				}
+				test.AssertDeepEquals(t, resolved, tc.wantResolved)
+				used = append(used, record.AddressUsed.String())
+			}
+			test.AssertDeepEquals(t, used, tc.wantUsed)
+		})
+	}
+}
+
+func TestCAAChallTestSrvParentRecord(t *testing.T) {
+	testCases := []struct {
+		name      string
+		domain    string
+		issuer    string
+		wantValid bool
+		wantWalk  []string
+	}{
+		{
+			name:      "one level up permits issuance",
+			domain:    "www.example.com",
+			issuer:    "letsencrypt.org",
+			wantValid: true,
+			wantWalk:  []string{"www.example.com.", "example.com."},
+		},
+		{
+			name:      "two levels up permits issuance",
+			domain:    "www.sub.example.com",
+			issuer:    "letsencrypt.org",
+			wantValid: true,
+			wantWalk:  []string{"www.sub.example.com.", "sub.example.com.", "example.com."},
+		},
+		{
+			name:      "two levels up forbids issuance",
+			domain:    "www.sub.example.com",
+			issuer:    "ca.example.net",
+			wantValid: false,
+			wantWalk:  []string{"www.sub.example.com.", "sub.example.com.", "example.com."},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			srv.AddDNSCAARecord("example.com", []challtestsrv.MockCAAPolicy{
+				{Tag: "issue", Value: tc.issuer},
+			})
+
+			prob := va.checkCAA(ctx, dnsi(tc.domain), &caaParams{validationMethod: "http-01"})
+			if tc.wantValid && prob != nil {
+				t.Errorf("CAA check failed: %s", prob)
+			}
+			if !tc.wantValid && prob == nil {
+				t.Errorf("CAA check passed despite a CAA record for %s", tc.issuer)
+			}
+
+			queried := make(map[string]bool)
+			for _, req := range srv.DNSRequests() {
+				if req.Qtype == dns.TypeCAA {
+					queried[req.Name] = true
+				}
+			}
+			for _, name := range tc.wantWalk {
+				test.Assert(t, queried[name], "No CAA query for "+name)
+			}
+		})
+	}
+}
+
+func TestChallTestSrvIPv6Loopback(t *testing.T) {
+	testCases := []struct {
+		name     string
+		validate func(*ValidationAuthorityImpl) ([]core.ValidationRecord, *probs.ProblemDetails)
+	}{
+		{
+			name: "HTTP-01",
+			validate: func(va *ValidationAuthorityImpl) ([]core.ValidationRecord, *probs.ProblemDetails) {
+				return va.validateHTTP01(ctx, dnsi("example.com"), httpChallenge())
+			},
+		},
+		{
+			name: "TLS-ALPN-01",
+			validate: func(va *ValidationAuthorityImpl) ([]core.ValidationRecord, *probs.ProblemDetails) {
+				return va.validateTLSALPN01(ctx, dnsi("example.com"), tlsalpnChallenge())
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{
+				HTTPOneAddrs:    []string{"[::1]:0"},
+				TLSALPNOneAddrs: []string{"[::1]:0"},
+			})
+			srv.SetDefaultDNSIPv4("")
+			srv.AddDNSAAAARecord("example.com", []string{"::1"})
+			srv.AddHTTPOneChallenge(expectedToken, expectedKeyAuthorization)
+			srv.AddTLSALPNChallenge("example.com", expectedKeyAuthorization)
+
+			records, prob := tc.validate(va)
+			if prob != nil {
+				t.Fatalf("Validation failed: %s", prob)
+			}
+			test.AssertEquals(t, len(records), 1)
+			test.AssertEquals(t, records[0].AddressUsed.String(), "::1")
+		})
+	}
+}
+
+func TestDNSChallTestSrvLongTXT(t *testing.T) {
+	testCases := []struct {
+		name   string
+		length int
+	}{
+		{name: "one full character-string", length: 255},
+		{name: "just over one character-string", length: 256},
+		{name: "300 bytes", length: 300},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			value := strings.Repeat("a", tc.length)
+			srv.AddDNSOneChallenge("_acme-challenge.example.com.", value)
+
+			txts, err := va.dnsClient.LookupTXT(ctx, "_acme-challenge.example.com")
+			test.AssertNotError(t, err, "LookupTXT failed")
+			test.AssertDeepEquals(t, txts, []string{value})
+		})
+	}
+}
+
+func TestDNSChallTestSrvWildcard(t *testing.T) {
+	chall := dnsChallenge()
+
+	testCases := []struct {
+		name  string
+		add   func(srv *challtestsrv.ChallSrv, digest string)
+		valid bool
+	}{
+		{
+			name: "challenge at the base domain",
+			add: func(srv *challtestsrv.ChallSrv, digest string) {
+				srv.AddWildcardDNSOneChallenge("*.example.com", digest)
+			},
+			valid: true,
+		},
+		{
+			name: "challenge at the wildcard name",
+			add: func(srv *challtestsrv.ChallSrv, digest string) {
+				srv.AddDNSOneChallenge("_acme-challenge.*.example.com.", digest)
+			},
+			valid: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			tc.add(srv, dnsChallengeDigest(chall))
+
+			_, prob := va.validate(ctx, dnsi("*.example.com"), 1, chall)
+			if tc.valid && prob != nil {
+				t.Errorf("Validation failed: %s", prob)
+			}
+			if !tc.valid && prob == nil {
+				t.Error("Validation succeeded without a TXT record at the base domain")
+			}
+		})
+	}
+}
+
+func TestHTTPChallTestSrvConnectionReset(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reset    bool
+		wantProb probs.ProblemType
+	}{
+		{name: "connection reset", reset: true, wantProb: probs.ConnectionProblem},
+		{name: "no connection reset", reset: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			va, srv := setupChallTestSrv(t, challtestsrv.Config{})
+			srv.AddHTTPOneChallenge(expectedToken, expectedKeyAuthorization)
+			srv.SetHTTPOneConnectionReset(expectedToken, tc.reset)
+
+			_, prob := va.validateHTTP01(ctx, dnsi("example.com"), httpChallenge())
+			if tc.wantProb == "" {
+				if prob != nil {
+					t.Errorf("Validation failed: %s", prob)
+				}
+				return
+			}
+			if prob == nil {
+				t.Fatal("Validation succeeded against a reset connection")
+			}
+			test.AssertEquals(t, prob.Type, tc.wantProb)
+		})
+	}
+}